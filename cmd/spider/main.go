@@ -2,192 +2,189 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
-	"runtime"
-	"strconv"
-	"time"
-	"web-spider/internal/database/mongodb"
-	"web-spider/internal/filter"
-	"web-spider/internal/frontier"
-	"web-spider/internal/metrics"
-	"web-spider/internal/parser"
-	"web-spider/internal/spider"
-	"web-spider/pkg/logger"
+	"os"
+	"os/signal"
+	"syscall"
+	"web-spider/internal/config"
+	"web-spider/internal/crawler"
 )
 
-func main() {
-	runtime.GOMAXPROCS(8)
-	fmt.Println("GOMAXPROCS:", runtime.GOMAXPROCS(0))
+const usage = `Usage: spider <command> [flags]
 
-	env := flag.String("env", "prod", "Application environment.")
-	threshold := flag.Int("threshold", 100, "Maximum number of pages to crawl.")
+Commands:
+  crawl      Crawl the web with concurrent workers, or one loop with --sequential.
+  validate   Validate the configuration and print the effective settings.
+  help       Show this help.
 
-	flag.Parse()
+Settings are resolved from the defaults, then the -config file, then the
+SPIDER_* environment variables, then the command line flags.
 
-	// DATABASE SETUP
-	dbAccess := true
-	var loading error
-	if *env == "test" {
-		loading = godotenv.Load(".env.test")
-	} else {
-		loading = godotenv.Load(".env")
-	}
-	if loading != nil {
-		logger.Error("Error loading .env file. Preventing access to crawler dataset.")
-		dbAccess = false
-	}
+Run 'spider <command> -h' for the flags of a command.
+`
 
-	dbConnection := mongodb.DatabaseConnection{
-		IsAccessible: dbAccess,
-		Uri:          "",
-		Client:       nil,
-		Collection:   nil,
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	dbConnection.Connect()
-	defer dbConnection.Disconnect()
-
-	textIdx := mongo.IndexModel{
-		Keys:    bson.D{{Key: "text", Value: "text"}},
-		Options: options.Index().SetName("TextIndex"),
-	}
-	urlIdx := mongo.IndexModel{
-		Keys:    bson.D{{Key: "url", Value: 1}},
-		Options: options.Index().SetName("UrlIndex"),
-	}
-	if dbConnection.IsAccessible {
-		_, err := dbConnection.Collection.Indexes().CreateOne(context.TODO(), textIdx)
-		if err != nil {
-			fmt.Println(err)
-		}
-		_, err = dbConnection.Collection.Indexes().CreateOne(context.TODO(), urlIdx)
+	switch os.Args[1] {
+	case "crawl":
+		cfg := loadConfig("crawl", os.Args[2:])
+		c, err := crawler.New(cfg)
 		if err != nil {
-			fmt.Println(err)
+			log.Fatal(err)
 		}
-	} else {
-		log.Fatal("Database is not accessible. Halting crawler.")
-	}
+		defer c.Close()
 
-	// STRUCTURES SETUP
-	urlFrontier := frontier.Frontier{Items: make([]string, 0, 1000)}
-	crawlerSet := filter.UrlSet{Set: make(map[uint64]bool, 1000)}
-	seeds := []string{
-		"https://news.ycombinator.com",
-		"https://wikipedia.org",
-	}
+		// INTERRUPTING STOPS THE CRAWL AND CANCELS THE IN-FLIGHT REQUESTS
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
-	// STATS SETUP
-	crawlerStats := metrics.NewCrawlerStats()
-	done := make(chan bool)
-	ticker := time.NewTicker(time.Second)
-
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case t := <-ticker.C:
-				crawlerStats.CrawlingPerMinuteRate(&urlFrontier, &crawlerSet, t)
-			}
+		if err = c.Run(ctx); err != nil {
+			log.Fatal(err)
 		}
-	}()
-
-	for _, seed := range seeds {
-		nUrl, err := filter.NormalizeUrl(seed)
+	case "validate":
+		cfg := loadConfig("validate", os.Args[2:])
+		out, err := json.MarshalIndent(cfg, "", "  ")
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		urlFrontier.Enqueue(nUrl)
-		crawlerSet.Add(nUrl)
-
-		crawlerStats.TotalSeen++
-		crawlerStats.UniqueEnqueued++
+		fmt.Println(string(out))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command `%s`.\n\n%s", os.Args[1], usage)
+		os.Exit(2)
 	}
+}
 
-	// Kick-start the crawling flow...
-	for urlFrontier.Size() > 0 && urlFrontier.TotalProcessedUrls() < *threshold {
-		urlItem := urlFrontier.Dequeue()
-
-		nUrl, err := filter.NormalizeUrl(urlItem)
-		if err != nil {
-			fmt.Println(err)
+// loadConfig binds the flags straight to the config fields, remembers the ones
+// explicitly set, and re-applies them once the config file and the environment
+// are loaded so they take precedence.
+func loadConfig(command string, args []string) *config.Config {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := fs.String("config", "", "JSON crawl configuration file.")
+
+	cfg := config.Default()
+	registerFlags(fs, cfg)
+	fs.Parse(args)
+
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	loaded, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	*cfg = *loaded
+	if err = cfg.ApplyEnv(); err != nil {
+		log.Fatal(err)
+	}
+	// A FRESH FLAG SET, SO THAT REPEATED FLAGS REPLACE THE LOADED LISTS
+	// INSTEAD OF ADDING TO THEM
+	fs = flag.NewFlagSet(command, flag.ExitOnError)
+	registerFlags(fs, cfg)
+	for name, value := range explicit {
+		if name == "config" {
 			continue
 		}
-
-		fmt.Println("Crawling: `" + nUrl + "` - Crawling count: " + strconv.Itoa(crawlerSet.Size()))
-
-		rawMarkup, err := spider.DownloadHTML(nUrl, crawlerStats)
-		if err != nil {
-			fmt.Println(err)
-			continue
+		if err = fs.Set(name, value); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		wp, err := parser.ParseHTML(nUrl, rawMarkup)
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
+	if err = cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 
-		if wp.Title == "" {
-			logger.Warn(fmt.Sprintf("Skipping page without a title: %s\n", wp.Title))
-			continue
-		}
-		if wp.Text == "" && len(wp.Links) == 0 {
-			logger.Warn(fmt.Sprintf("Skipping empty page: %s\n", wp.Url))
-			crawlerStats.EmptyPages++
-			continue
-		}
+	return cfg
+}
 
-		resultOp := dbConnection.InsertWebPage(wp, crawlerStats)
-		if resultOp {
-			crawlerSet.Add(nUrl)
-		}
+func registerFlags(fs *flag.FlagSet, cfg *config.Config) {
+	fs.StringVar(&cfg.Env, "env", cfg.Env, "Application environment, `test` reads the .env.test file.")
+	fs.Var(&cfg.Seeds, "seeds", "Comma-separated seed URLs.")
+	fs.Var(&cfg.SeedFiles, "seed-files", "Comma-separated files holding one seed URL per line.")
+	fs.BoolVar(&cfg.Sequential, "sequential", cfg.Sequential, "Crawl with a single sequential loop instead of concurrent workers.")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "Number of concurrent workers.")
+	fs.IntVar(&cfg.MaxProcs, "max-procs", cfg.MaxProcs, "GOMAXPROCS, 0 keeps the runtime default.")
+	fs.StringVar(&cfg.UserAgent, "user-agent", cfg.UserAgent, "User-Agent sent with every request and matched against robots.txt.")
+	fs.StringVar(&cfg.HTTP.From, "from", cfg.HTTP.From, "Contact address sent in the From header.")
+	fs.Var(&cfg.HTTP.ConnectTimeout, "connect-timeout", "Timeout of the TCP and TLS handshakes.")
+	fs.Var(&cfg.HTTP.ReadTimeout, "read-timeout", "Timeout waiting for the response headers, then for each chunk of the body.")
+	fs.Var(&cfg.HTTP.Timeout, "timeout", "Timeout of a whole request.")
+	fs.IntVar(&cfg.HTTP.MaxConnsPerHost, "max-conns-per-host", cfg.HTTP.MaxConnsPerHost, "Maximum open connections to a single host, 0 means unlimited.")
+	fs.IntVar(&cfg.HTTP.MaxIdleConnsPerHost, "max-idle-conns-per-host", cfg.HTTP.MaxIdleConnsPerHost, "Maximum idle connections kept open to a single host.")
+	fs.IntVar(&cfg.HTTP.MaxRedirects, "max-redirects", cfg.HTTP.MaxRedirects, "Longest redirect chain followed, 0 follows none.")
+	fs.Int64Var(&cfg.HTTP.MaxBodySize, "max-body-size", cfg.HTTP.MaxBodySize, "Maximum bytes read from a response body, 0 means unlimited.")
+	fs.StringVar(&cfg.HTTP.OversizePolicy, "oversize-policy", cfg.HTTP.OversizePolicy, "What to do with a body past -max-body-size: truncate or reject.")
+	fs.Float64Var(&cfg.HTTP.MaxDecompressionRatio, "max-decompression-ratio", cfg.HTTP.MaxDecompressionRatio, "Maximum decoded to wire size ratio of a compressed body, 0 disables the compression bomb check.")
+	fs.StringVar(&cfg.HTTP.Proxy, "proxy", cfg.HTTP.Proxy, "Proxy url, defaults to the HTTP_PROXY and HTTPS_PROXY environment variables.")
+	fs.BoolVar(&cfg.HTTP.ConditionalRequests, "conditional", cfg.HTTP.ConditionalRequests, "Revalidate stored pages with If-None-Match/If-Modified-Since, skipping unchanged ones.")
+	fs.IntVar(&cfg.Retry.MaxAttempts, "max-attempts", cfg.Retry.MaxAttempts, "Maximum number of fetch attempts of a url, 1 disables retries.")
+	fs.Var(&cfg.Retry.BaseDelay, "retry-base-delay", "Delay before the first retry, doubled on each following one.")
+	fs.Var(&cfg.Retry.MaxDelay, "retry-max-delay", "Longest delay between two attempts, a longer Retry-After gives up on the url.")
+	fs.Float64Var(&cfg.Retry.Jitter, "retry-jitter", cfg.Retry.Jitter, "Random spread of the retry delays, as a fraction of the delay.")
+	fs.StringVar(&cfg.Normalization, "normalization", cfg.Normalization, "JSON file with URL normalization rules.")
+	fs.IntVar(&cfg.Limits.MaxPages, "threshold", cfg.Limits.MaxPages, "Maximum number of pages to crawl.")
+	fs.IntVar(&cfg.Limits.EnqueueLimit, "enqueue-limit", cfg.Limits.EnqueueLimit, "Maximum number of URLs to enqueue, defaults to -threshold. Raise it to give the prioritizer more candidates.")
+	fs.Var(&cfg.Politeness.Delay, "delay", "Minimum delay between two requests to the same host.")
+	fs.Var(&cfg.Politeness.RobotsTTL, "robots-ttl", "How long a host's robots.txt is cached.")
+	fs.StringVar(&cfg.Frontier.Kind, "frontier", cfg.Frontier.Kind, "Frontier storage: memory, disk or mongo (shared by several crawler processes).")
+	fs.StringVar(&cfg.Frontier.Priority, "priority", cfg.Frontier.Priority, "Frontier prioritizer: fifo, depth, inlinks, domain or pattern.")
+	fs.Var(&cfg.Frontier.PriorityRules, "priority-rules", "Comma-separated key=weight rules for the domain and pattern prioritizers.")
+	fs.StringVar(&cfg.Frontier.DataDir, "data-dir", cfg.Frontier.DataDir, "Directory holding the disk frontier journal and seen set checkpoints.")
+	fs.BoolVar(&cfg.Frontier.Resume, "resume", cfg.Frontier.Resume, "Resume the previous crawl instead of seeding a new one. Requires -frontier=disk or -frontier=mongo.")
+	fs.Var(&cfg.Frontier.Checkpoint, "checkpoint", "How often the disk frontier and seen set are checkpointed.")
+	fs.Var(&cfg.Frontier.Lease, "lease", "How long a url claimed from the mongo frontier is leased before another process may claim it.")
+	fs.StringVar(&cfg.SeenSet.Kind, "seen-set", cfg.SeenSet.Kind, "Seen set implementation: map (exact) or bloom (scalable Bloom filter).")
+	fs.Float64Var(&cfg.SeenSet.FPRate, "fp-rate", cfg.SeenSet.FPRate, "Target false-positive rate of the bloom seen set.")
+	fs.Var(&cfg.Scope.AllowedDomains, "allowed-domains", "Comma-separated domains the crawl is restricted to, subdomains included.")
+	fs.Var(&cfg.Scope.BlockedDomains, "blocked-domains", "Comma-separated domains never crawled, subdomains included.")
+	fs.Var(&patternsFlag{patterns: &cfg.Scope.Include}, "include", "Regular expression a url must match to be crawled, repeat the flag to accept urls matching any of several.")
+	fs.Var(&patternsFlag{patterns: &cfg.Scope.Exclude}, "exclude", "Regular expression of urls not crawled, repeat the flag for several.")
+	fs.IntVar(&cfg.Scope.MaxDepth, "max-depth", cfg.Scope.MaxDepth, "Maximum number of hops from a seed, 0 means unlimited.")
+	fs.IntVar(&cfg.Scope.MaxPagesPerHost, "max-pages-per-host", cfg.Scope.MaxPagesPerHost, "Maximum number of URLs enqueued per host, 0 means unlimited.")
+	fs.Var(&cfg.Scope.BlockedExtensions, "blocked-extensions", "Comma-separated file extensions never crawled.")
+	fs.StringVar(&cfg.Extraction.Extractor, "extractor", cfg.Extraction.Extractor, "Page text extractor: full (all visible text) or readability (main content only).")
+	fs.IntVar(&cfg.Extraction.MaxWords, "max-text-words", cfg.Extraction.MaxWords, "Maximum number of words of text kept per page, 0 means unlimited.")
+	fs.IntVar(&cfg.Extraction.MaxBytes, "max-text-bytes", cfg.Extraction.MaxBytes, "Maximum bytes of text kept per page, 0 means unlimited.")
+	fs.StringVar(&cfg.Dedup.Policy, "dedup", cfg.Dedup.Policy, "What to do with duplicate pages: off, skip them, or link them to the page they duplicate.")
+	fs.IntVar(&cfg.Dedup.MaxDistance, "dedup-distance", cfg.Dedup.MaxDistance, "Maximum SimHash Hamming distance of near-duplicate pages, 0 only catches identical fingerprints.")
+	fs.BoolVar(&cfg.Recrawl.Enabled, "recrawl", cfg.Recrawl.Enabled, "Also revisit stored pages whose next visit time has passed.")
+	fs.Var(&cfg.Recrawl.MinInterval, "recrawl-min-interval", "Shortest revisit interval, reached by pages changing on every visit.")
+	fs.Var(&cfg.Recrawl.MaxInterval, "recrawl-max-interval", "Longest revisit interval, reached by pages that never change.")
+	fs.Var(&cfg.Recrawl.InitialInterval, "recrawl-initial-interval", "Revisit interval of a page crawled for the first time.")
+	fs.IntVar(&cfg.Recrawl.BatchSize, "recrawl-batch", cfg.Recrawl.BatchSize, "Maximum number of due pages enqueued at once.")
+	fs.Var(&cfg.Recrawl.Poll, "recrawl-poll", "How often stored pages are polled for due revisits.")
+	fs.StringVar(&cfg.Storage.Target, "storage", cfg.Storage.Target, "Storage target, only mongodb is supported.")
+	fs.StringVar(&cfg.Storage.EnvFile, "env-file", cfg.Storage.EnvFile, "Dotenv file with the storage credentials, defaults to .env or .env.test.")
+}
 
-		for _, link := range wp.Links {
-			url, err := filter.NormalizeUrl(link)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-
-			if !crawlerSet.Contains(url) {
-				if crawlerStats.UniqueEnqueued >= *threshold {
-					break
-				}
-				urlFrontier.Enqueue(url)
-
-				crawlerStats.TotalSeen++
-				crawlerStats.UniqueEnqueued++
-			} else {
-				logger.Info(fmt.Sprintf("Skipping: `%s` is already discovered.", url))
-				crawlerStats.SkippedDuplicates++
-			}
-		}
+// patternsFlag adds a regular expression to a list on each use. The first use
+// replaces the patterns coming from the defaults, config file or environment.
+type patternsFlag struct {
+	patterns *config.PatternList
+	used     bool
+}
+
+func (f *patternsFlag) String() string {
+	if f.patterns == nil {
+		return ""
 	}
+	return f.patterns.String()
+}
 
-	logger.Info(fmt.Sprintf("\n\nTotal Procesed: `%d`\n\n", urlFrontier.TotalProcessedUrls()))
-	ticker.Stop()
-	done <- true
-
-	logger.Info(fmt.Sprintf("Raw Stats → TotalSeen: %d, UniqueEnqueued: %d, DBInserted: %d, DBInsertAttempts: %d, FailedInserts: %d, HTMLPages: %d, EmptyPages: %d, SkippedDuplicates: %d, HTTPErrors: %d",
-		crawlerStats.TotalSeen,
-		crawlerStats.UniqueEnqueued,
-		crawlerStats.DBInserted,
-		crawlerStats.DBInsertAttempts,
-		crawlerStats.FailedInserts,
-		crawlerStats.HTMLPages,
-		crawlerStats.EmptyPages,
-		crawlerStats.SkippedDuplicates,
-		crawlerStats.HTTPErrors,
-	))
-	crawlerStats.PrintTimingStats()
-	crawlerStats.PrintGeneralStats()
-	fmt.Printf("\n\nProgram Finished. It took: %v\n\n", time.Since(crawlerStats.StartedAt))
+func (f *patternsFlag) Set(value string) error {
+	if !f.used {
+		*f.patterns = nil
+		f.used = true
+	}
+	return f.patterns.Set(value)
 }
@@ -0,0 +1,607 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web-spider/internal/dedup"
+	"web-spider/internal/parser"
+	"web-spider/internal/recrawl"
+	"web-spider/internal/scope"
+	"web-spider/internal/spider"
+)
+
+// Duration is a time.Duration written as "1s", "5m", ... in config files and
+// on the command line.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("durations must be strings like \"1s\": %w", err)
+	}
+	return d.Set(value)
+}
+
+// StringList is a comma-separated list on the command line.
+type StringList []string
+
+func (l StringList) String() string {
+	return strings.Join(l, ",")
+}
+
+func (l *StringList) Set(value string) error {
+	*l = nil
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// PatternList is a list of regular expressions. Patterns may hold commas, so
+// they are given one per line in the environment, and one per use of a
+// repeatable flag on the command line.
+type PatternList []string
+
+func (l PatternList) String() string {
+	return strings.Join(l, "\n")
+}
+
+// Set adds the patterns of value, one per line.
+func (l *PatternList) Set(value string) error {
+	for _, v := range strings.Split(value, "\n") {
+		if v = strings.TrimRight(v, "\r"); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+type Limits struct {
+	MaxPages     int `json:"maxPages"`
+	EnqueueLimit int `json:"enqueueLimit"`
+}
+
+type Politeness struct {
+	Delay     Duration `json:"delay"`
+	RobotsTTL Duration `json:"robotsTtl"`
+}
+
+type HTTP struct {
+	From                  string   `json:"from"`
+	ConnectTimeout        Duration `json:"connectTimeout"`
+	ReadTimeout           Duration `json:"readTimeout"`
+	Timeout               Duration `json:"timeout"`
+	MaxConnsPerHost       int      `json:"maxConnsPerHost"`
+	MaxIdleConnsPerHost   int      `json:"maxIdleConnsPerHost"`
+	MaxRedirects          int      `json:"maxRedirects"`
+	MaxBodySize           int64    `json:"maxBodySize"`
+	OversizePolicy        string   `json:"oversizePolicy"`
+	MaxDecompressionRatio float64  `json:"maxDecompressionRatio"`
+	Proxy                 string   `json:"proxy"`
+	ConditionalRequests   bool     `json:"conditionalRequests"`
+}
+
+type Retry struct {
+	MaxAttempts int      `json:"maxAttempts"`
+	BaseDelay   Duration `json:"baseDelay"`
+	MaxDelay    Duration `json:"maxDelay"`
+	Jitter      float64  `json:"jitter"`
+}
+
+type Frontier struct {
+	Kind          string     `json:"kind"`
+	Priority      string     `json:"priority"`
+	PriorityRules StringList `json:"priorityRules"`
+	DataDir       string     `json:"dataDir"`
+	Resume        bool       `json:"resume"`
+	Checkpoint    Duration   `json:"checkpoint"`
+	Lease         Duration   `json:"lease"`
+}
+
+type SeenSet struct {
+	Kind   string  `json:"kind"`
+	FPRate float64 `json:"fpRate"`
+}
+
+type Scope struct {
+	AllowedDomains    StringList  `json:"allowedDomains"`
+	BlockedDomains    StringList  `json:"blockedDomains"`
+	Include           PatternList `json:"include"`
+	Exclude           PatternList `json:"exclude"`
+	MaxDepth          int         `json:"maxDepth"`
+	MaxPagesPerHost   int         `json:"maxPagesPerHost"`
+	BlockedExtensions StringList  `json:"blockedExtensions"`
+}
+
+type Extraction struct {
+	Extractor string `json:"extractor"`
+	MaxWords  int    `json:"maxWords"`
+	MaxBytes  int    `json:"maxBytes"`
+}
+
+type Dedup struct {
+	Policy      string `json:"policy"`
+	MaxDistance int    `json:"maxDistance"`
+}
+
+type Recrawl struct {
+	Enabled         bool     `json:"enabled"`
+	MinInterval     Duration `json:"minInterval"`
+	MaxInterval     Duration `json:"maxInterval"`
+	InitialInterval Duration `json:"initialInterval"`
+	BatchSize       int      `json:"batchSize"`
+	Poll            Duration `json:"poll"`
+}
+
+type Storage struct {
+	Target  string `json:"target"`
+	EnvFile string `json:"envFile"`
+}
+
+type Config struct {
+	Env           string     `json:"env"`
+	Seeds         StringList `json:"seeds"`
+	SeedFiles     StringList `json:"seedFiles"`
+	Sequential    bool       `json:"sequential"`
+	Workers       int        `json:"workers"`
+	MaxProcs      int        `json:"maxProcs"`
+	UserAgent     string     `json:"userAgent"`
+	Normalization string     `json:"normalization"`
+	HTTP          HTTP       `json:"http"`
+	Retry         Retry      `json:"retry"`
+	Limits        Limits     `json:"limits"`
+	Politeness    Politeness `json:"politeness"`
+	Frontier      Frontier   `json:"frontier"`
+	SeenSet       SeenSet    `json:"seenSet"`
+	Scope         Scope      `json:"scope"`
+	Extraction    Extraction `json:"extraction"`
+	Dedup         Dedup      `json:"dedup"`
+	Recrawl       Recrawl    `json:"recrawl"`
+	Storage       Storage    `json:"storage"`
+}
+
+func Default() *Config {
+	return &Config{
+		Env:       "prod",
+		Workers:   16,
+		UserAgent: "web-spider/1.0",
+		HTTP: HTTP{
+			ConnectTimeout:        Duration(10 * time.Second),
+			ReadTimeout:           Duration(15 * time.Second),
+			Timeout:               Duration(30 * time.Second),
+			MaxConnsPerHost:       4,
+			MaxIdleConnsPerHost:   4,
+			MaxRedirects:          10,
+			MaxBodySize:           10 << 20,
+			OversizePolicy:        "truncate",
+			MaxDecompressionRatio: 100,
+			ConditionalRequests:   true,
+		},
+		Retry: Retry{
+			MaxAttempts: 3,
+			BaseDelay:   Duration(2 * time.Second),
+			MaxDelay:    Duration(2 * time.Minute),
+			Jitter:      0.2,
+		},
+		Limits: Limits{
+			MaxPages: 100,
+		},
+		Politeness: Politeness{
+			Delay:     Duration(time.Second),
+			RobotsTTL: Duration(24 * time.Hour),
+		},
+		Frontier: Frontier{
+			Kind:       "memory",
+			Priority:   "fifo",
+			DataDir:    "crawl-data",
+			Checkpoint: Duration(30 * time.Second),
+			Lease:      Duration(5 * time.Minute),
+		},
+		SeenSet: SeenSet{
+			Kind:   "map",
+			FPRate: 0.001,
+		},
+		Scope: Scope{
+			BlockedExtensions: StringList{
+				"jpg", "jpeg", "png", "gif", "webp", "svg", "ico", "bmp",
+				"mp3", "mp4", "avi", "mov", "webm", "wav",
+				"pdf", "zip", "gz", "tar", "rar", "7z", "exe", "dmg", "iso",
+				"css", "js", "woff", "woff2", "ttf",
+			},
+		},
+		Extraction: Extraction{
+			Extractor: parser.ExtractorFull,
+			MaxWords:  500,
+		},
+		Dedup: Dedup{
+			Policy:      "skip",
+			MaxDistance: 3,
+		},
+		Recrawl: Recrawl{
+			MinInterval:     Duration(time.Hour),
+			MaxInterval:     Duration(30 * 24 * time.Hour),
+			InitialInterval: Duration(24 * time.Hour),
+			BatchSize:       1000,
+			Poll:            Duration(time.Minute),
+		},
+		Storage: Storage{
+			Target: "mongodb",
+		},
+	}
+}
+
+// Load reads a JSON config file over the defaults. Fields missing from the
+// file keep their default value.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// ApplyEnv overrides the config with the SPIDER_* environment variables.
+func (c *Config) ApplyEnv() error {
+	overrides := []struct {
+		name string
+		set  func(string) error
+	}{
+		{"SPIDER_ENV", setString(&c.Env)},
+		{"SPIDER_SEEDS", (&c.Seeds).Set},
+		{"SPIDER_SEED_FILES", (&c.SeedFiles).Set},
+		{"SPIDER_SEQUENTIAL", setBool(&c.Sequential)},
+		{"SPIDER_WORKERS", setInt(&c.Workers)},
+		{"SPIDER_MAX_PROCS", setInt(&c.MaxProcs)},
+		{"SPIDER_USER_AGENT", setString(&c.UserAgent)},
+		{"SPIDER_NORMALIZATION", setString(&c.Normalization)},
+		{"SPIDER_FROM", setString(&c.HTTP.From)},
+		{"SPIDER_CONNECT_TIMEOUT", (&c.HTTP.ConnectTimeout).Set},
+		{"SPIDER_READ_TIMEOUT", (&c.HTTP.ReadTimeout).Set},
+		{"SPIDER_TIMEOUT", (&c.HTTP.Timeout).Set},
+		{"SPIDER_MAX_CONNS_PER_HOST", setInt(&c.HTTP.MaxConnsPerHost)},
+		{"SPIDER_MAX_IDLE_CONNS_PER_HOST", setInt(&c.HTTP.MaxIdleConnsPerHost)},
+		{"SPIDER_MAX_REDIRECTS", setInt(&c.HTTP.MaxRedirects)},
+		{"SPIDER_MAX_BODY_SIZE", setInt64(&c.HTTP.MaxBodySize)},
+		{"SPIDER_OVERSIZE_POLICY", setString(&c.HTTP.OversizePolicy)},
+		{"SPIDER_MAX_DECOMPRESSION_RATIO", setFloat(&c.HTTP.MaxDecompressionRatio)},
+		{"SPIDER_PROXY", setString(&c.HTTP.Proxy)},
+		{"SPIDER_CONDITIONAL_REQUESTS", setBool(&c.HTTP.ConditionalRequests)},
+		{"SPIDER_MAX_ATTEMPTS", setInt(&c.Retry.MaxAttempts)},
+		{"SPIDER_RETRY_BASE_DELAY", (&c.Retry.BaseDelay).Set},
+		{"SPIDER_RETRY_MAX_DELAY", (&c.Retry.MaxDelay).Set},
+		{"SPIDER_RETRY_JITTER", setFloat(&c.Retry.Jitter)},
+		{"SPIDER_MAX_PAGES", setInt(&c.Limits.MaxPages)},
+		{"SPIDER_ENQUEUE_LIMIT", setInt(&c.Limits.EnqueueLimit)},
+		{"SPIDER_DELAY", (&c.Politeness.Delay).Set},
+		{"SPIDER_ROBOTS_TTL", (&c.Politeness.RobotsTTL).Set},
+		{"SPIDER_FRONTIER", setString(&c.Frontier.Kind)},
+		{"SPIDER_PRIORITY", setString(&c.Frontier.Priority)},
+		{"SPIDER_PRIORITY_RULES", (&c.Frontier.PriorityRules).Set},
+		{"SPIDER_DATA_DIR", setString(&c.Frontier.DataDir)},
+		{"SPIDER_RESUME", setBool(&c.Frontier.Resume)},
+		{"SPIDER_CHECKPOINT", (&c.Frontier.Checkpoint).Set},
+		{"SPIDER_LEASE", (&c.Frontier.Lease).Set},
+		{"SPIDER_SEEN_SET", setString(&c.SeenSet.Kind)},
+		{"SPIDER_FP_RATE", setFloat(&c.SeenSet.FPRate)},
+		{"SPIDER_ALLOWED_DOMAINS", (&c.Scope.AllowedDomains).Set},
+		{"SPIDER_BLOCKED_DOMAINS", (&c.Scope.BlockedDomains).Set},
+		{"SPIDER_INCLUDE", setPatterns(&c.Scope.Include)},
+		{"SPIDER_EXCLUDE", setPatterns(&c.Scope.Exclude)},
+		{"SPIDER_MAX_DEPTH", setInt(&c.Scope.MaxDepth)},
+		{"SPIDER_MAX_PAGES_PER_HOST", setInt(&c.Scope.MaxPagesPerHost)},
+		{"SPIDER_BLOCKED_EXTENSIONS", (&c.Scope.BlockedExtensions).Set},
+		{"SPIDER_EXTRACTOR", setString(&c.Extraction.Extractor)},
+		{"SPIDER_MAX_TEXT_WORDS", setInt(&c.Extraction.MaxWords)},
+		{"SPIDER_MAX_TEXT_BYTES", setInt(&c.Extraction.MaxBytes)},
+		{"SPIDER_DEDUP", setString(&c.Dedup.Policy)},
+		{"SPIDER_DEDUP_DISTANCE", setInt(&c.Dedup.MaxDistance)},
+		{"SPIDER_RECRAWL", setBool(&c.Recrawl.Enabled)},
+		{"SPIDER_RECRAWL_MIN_INTERVAL", (&c.Recrawl.MinInterval).Set},
+		{"SPIDER_RECRAWL_MAX_INTERVAL", (&c.Recrawl.MaxInterval).Set},
+		{"SPIDER_RECRAWL_INITIAL_INTERVAL", (&c.Recrawl.InitialInterval).Set},
+		{"SPIDER_RECRAWL_BATCH", setInt(&c.Recrawl.BatchSize)},
+		{"SPIDER_RECRAWL_POLL", (&c.Recrawl.Poll).Set},
+		{"SPIDER_STORAGE", setString(&c.Storage.Target)},
+		{"SPIDER_ENV_FILE", setString(&c.Storage.EnvFile)},
+	}
+
+	var errs []error
+	for _, o := range overrides {
+		value, ok := os.LookupEnv(o.name)
+		if !ok {
+			continue
+		}
+		if err := o.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(len(c.Seeds)+len(c.SeedFiles) > 0 || c.Frontier.Resume, "at least one seed or seed file is required")
+	check(c.Workers > 0, "workers must be positive, got %d", c.Workers)
+	check(c.MaxProcs >= 0, "maxProcs can't be negative, got %d", c.MaxProcs)
+	check(c.UserAgent != "", "userAgent is required")
+	check(c.HTTP.ConnectTimeout > 0, "http.connectTimeout must be positive")
+	check(c.HTTP.ReadTimeout > 0, "http.readTimeout must be positive")
+	check(c.HTTP.Timeout > 0, "http.timeout must be positive")
+	check(c.HTTP.MaxConnsPerHost >= 0, "http.maxConnsPerHost can't be negative, got %d", c.HTTP.MaxConnsPerHost)
+	check(c.HTTP.MaxIdleConnsPerHost >= 0, "http.maxIdleConnsPerHost can't be negative, got %d", c.HTTP.MaxIdleConnsPerHost)
+	check(c.HTTP.MaxRedirects >= 0, "http.maxRedirects can't be negative, got %d", c.HTTP.MaxRedirects)
+	check(c.HTTP.MaxBodySize >= 0, "http.maxBodySize can't be negative, got %d", c.HTTP.MaxBodySize)
+	check(oneOf(c.HTTP.OversizePolicy, "truncate", "reject"), "http.oversizePolicy must be truncate or reject, got `%s`", c.HTTP.OversizePolicy)
+	check(c.HTTP.MaxDecompressionRatio >= 0, "http.maxDecompressionRatio can't be negative, got %f", c.HTTP.MaxDecompressionRatio)
+	if c.HTTP.Proxy != "" {
+		proxy, err := url.Parse(c.HTTP.Proxy)
+		check(err == nil && proxy.Host != "", "http.proxy `%s` is not a valid url", c.HTTP.Proxy)
+	}
+	check(c.Retry.MaxAttempts > 0, "retry.maxAttempts must be positive, got %d", c.Retry.MaxAttempts)
+	check(c.Retry.BaseDelay > 0, "retry.baseDelay must be positive")
+	check(c.Retry.MaxDelay >= c.Retry.BaseDelay, "retry.maxDelay can't be shorter than retry.baseDelay")
+	check(c.Retry.Jitter >= 0 && c.Retry.Jitter <= 1, "retry.jitter must be in [0, 1], got %f", c.Retry.Jitter)
+	check(c.Limits.MaxPages > 0, "limits.maxPages must be positive, got %d", c.Limits.MaxPages)
+	check(c.Limits.EnqueueLimit >= 0, "limits.enqueueLimit can't be negative, got %d", c.Limits.EnqueueLimit)
+	check(c.Politeness.Delay >= 0, "politeness.delay can't be negative")
+	check(c.Politeness.RobotsTTL > 0, "politeness.robotsTtl must be positive")
+	check(oneOf(c.Frontier.Kind, "memory", "disk", "mongo"), "frontier.kind must be memory, disk or mongo, got `%s`", c.Frontier.Kind)
+	check(oneOf(c.Frontier.Priority, "fifo", "depth", "inlinks", "domain", "pattern"), "frontier.priority must be fifo, depth, inlinks, domain or pattern, got `%s`", c.Frontier.Priority)
+	check(!c.Frontier.Resume || c.Frontier.Kind != "memory", "frontier.resume requires the disk or mongo frontier")
+	check(c.Frontier.Kind != "disk" || c.Frontier.DataDir != "", "frontier.dataDir is required by the disk frontier")
+	check(c.Frontier.Checkpoint > 0, "frontier.checkpoint must be positive")
+	check(c.Frontier.Lease > 0, "frontier.lease must be positive")
+	check(oneOf(c.SeenSet.Kind, "map", "bloom"), "seenSet.kind must be map or bloom, got `%s`", c.SeenSet.Kind)
+	check(c.SeenSet.FPRate > 0 && c.SeenSet.FPRate < 1, "seenSet.fpRate must be in (0, 1), got %f", c.SeenSet.FPRate)
+	check(c.Scope.MaxDepth >= 0, "scope.maxDepth can't be negative, got %d", c.Scope.MaxDepth)
+	check(c.Scope.MaxPagesPerHost >= 0, "scope.maxPagesPerHost can't be negative, got %d", c.Scope.MaxPagesPerHost)
+	for _, p := range append(append([]string(nil), c.Scope.Include...), c.Scope.Exclude...) {
+		_, err := regexp.Compile(p)
+		check(err == nil, "scope pattern `%s` is invalid: %v", p, err)
+	}
+	check(oneOf(c.Extraction.Extractor, parser.ExtractorFull, parser.ExtractorReadability),
+		"extraction.extractor must be full or readability, got `%s`", c.Extraction.Extractor)
+	check(c.Extraction.MaxWords >= 0, "extraction.maxWords can't be negative, got %d", c.Extraction.MaxWords)
+	check(c.Extraction.MaxBytes >= 0, "extraction.maxBytes can't be negative, got %d", c.Extraction.MaxBytes)
+	check(oneOf(c.Dedup.Policy, dedup.PolicyOff, dedup.PolicySkip, dedup.PolicyLink), "dedup.policy must be off, skip or link, got `%s`", c.Dedup.Policy)
+	check(c.Dedup.MaxDistance >= 0 && c.Dedup.MaxDistance <= dedup.MaxDistanceLimit,
+		"dedup.maxDistance must be between 0 and %d, got %d", dedup.MaxDistanceLimit, c.Dedup.MaxDistance)
+	check(c.Recrawl.MinInterval > 0, "recrawl.minInterval must be positive")
+	check(c.Recrawl.MaxInterval >= c.Recrawl.MinInterval, "recrawl.maxInterval can't be shorter than recrawl.minInterval")
+	check(c.Recrawl.InitialInterval >= c.Recrawl.MinInterval && c.Recrawl.InitialInterval <= c.Recrawl.MaxInterval,
+		"recrawl.initialInterval must be between recrawl.minInterval and recrawl.maxInterval")
+	check(c.Recrawl.BatchSize > 0, "recrawl.batchSize must be positive, got %d", c.Recrawl.BatchSize)
+	check(c.Recrawl.Poll > 0, "recrawl.poll must be positive")
+	check(oneOf(c.Storage.Target, "mongodb"), "storage.target must be mongodb, got `%s`", c.Storage.Target)
+	readable := true
+	for _, f := range c.SeedFiles {
+		_, err := os.Stat(f)
+		check(err == nil, "seed file %s is not readable: %v", f, err)
+		readable = readable && err == nil
+	}
+	if readable {
+		seeds, err := c.AllSeeds()
+		check(err == nil, "seed files are not readable: %v", err)
+		for _, seed := range seeds {
+			check(isHttpUrl(seed), "seed `%s` is not an absolute http(s) url", seed)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// EnvFile is the dotenv file holding the storage credentials.
+func (c *Config) EnvFile() string {
+	if c.Storage.EnvFile != "" {
+		return c.Storage.EnvFile
+	}
+	if c.Env == "test" {
+		return ".env.test"
+	}
+	return ".env"
+}
+
+func (c *Config) FetcherOptions() spider.FetcherOptions {
+	return spider.FetcherOptions{
+		UserAgent:             c.UserAgent,
+		From:                  c.HTTP.From,
+		ConnectTimeout:        time.Duration(c.HTTP.ConnectTimeout),
+		ReadTimeout:           time.Duration(c.HTTP.ReadTimeout),
+		Timeout:               time.Duration(c.HTTP.Timeout),
+		MaxConnsPerHost:       c.HTTP.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   c.HTTP.MaxIdleConnsPerHost,
+		MaxRedirects:          c.HTTP.MaxRedirects,
+		MaxBodySize:           c.HTTP.MaxBodySize,
+		OversizePolicy:        c.HTTP.OversizePolicy,
+		MaxDecompressionRatio: c.HTTP.MaxDecompressionRatio,
+		Proxy:                 c.HTTP.Proxy,
+	}
+}
+
+func (c *Config) RetryPolicy() spider.RetryPolicy {
+	return spider.RetryPolicy{
+		MaxAttempts: c.Retry.MaxAttempts,
+		BaseDelay:   time.Duration(c.Retry.BaseDelay),
+		MaxDelay:    time.Duration(c.Retry.MaxDelay),
+		Jitter:      c.Retry.Jitter,
+	}
+}
+
+func (c *Config) ScopeRules() scope.Rules {
+	return scope.Rules{
+		AllowedDomains:    c.Scope.AllowedDomains,
+		BlockedDomains:    c.Scope.BlockedDomains,
+		Include:           c.Scope.Include,
+		Exclude:           c.Scope.Exclude,
+		MaxDepth:          c.Scope.MaxDepth,
+		MaxPagesPerHost:   c.Scope.MaxPagesPerHost,
+		BlockedExtensions: c.Scope.BlockedExtensions,
+	}
+}
+
+func (c *Config) EffectiveEnqueueLimit() int {
+	if c.Limits.EnqueueLimit > 0 {
+		return c.Limits.EnqueueLimit
+	}
+	return c.Limits.MaxPages
+}
+
+// AllSeeds returns the inline seeds followed by the ones read from the seed
+// files, one url per line, `#` starting a comment.
+func (c *Config) AllSeeds() ([]string, error) {
+	seeds := append([]string(nil), c.Seeds...)
+	for _, path := range c.SeedFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			if line = strings.TrimSpace(line); line != "" {
+				seeds = append(seeds, line)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return seeds, nil
+}
+
+func isHttpUrl(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func oneOf(value string, allowed ...string) bool {
+	return slices.Contains(allowed, value)
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+// setPatterns replaces target with the patterns of value, one per line.
+func setPatterns(target *PatternList) func(string) error {
+	return func(value string) error {
+		*target = nil
+		return target.Set(value)
+	}
+}
+
+func setInt(target *int) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setInt64(target *int64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setFloat(target *float64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func (c *Config) RecrawlPolicy() recrawl.Policy {
+	return recrawl.Policy{
+		MinInterval:     time.Duration(c.Recrawl.MinInterval),
+		MaxInterval:     time.Duration(c.Recrawl.MaxInterval),
+		InitialInterval: time.Duration(c.Recrawl.InitialInterval),
+	}
+}
+
+func (c *Config) ParserOptions() parser.Options {
+	return parser.Options{
+		Extractor: c.Extraction.Extractor,
+		MaxWords:  c.Extraction.MaxWords,
+		MaxBytes:  c.Extraction.MaxBytes,
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPatternListKeepsCommas(t *testing.T) {
+	var l PatternList
+	for _, v := range []string{`a{1,3}`, "b,c\nd\r\n"} {
+		if err := l.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := (PatternList{`a{1,3}`, "b,c", "d"}); !slices.Equal(l, want) {
+		t.Errorf("patterns = %q, want %q", l, want)
+	}
+}
+
+func TestApplyEnvPatterns(t *testing.T) {
+	t.Setenv("SPIDER_INCLUDE", "/docs/\n^https?://[^/]+/a{2,}")
+	t.Setenv("SPIDER_EXCLUDE", "[?&](a|b),c")
+
+	c := Default()
+	c.Scope.Include = PatternList{"from the config file"}
+	if err := c.ApplyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if want := (PatternList{"/docs/", "^https?://[^/]+/a{2,}"}); !slices.Equal(c.Scope.Include, want) {
+		t.Errorf("Include = %q, want %q", c.Scope.Include, want)
+	}
+	if want := (PatternList{"[?&](a|b),c"}); !slices.Equal(c.Scope.Exclude, want) {
+		t.Errorf("Exclude = %q, want %q", c.Scope.Exclude, want)
+	}
+}
@@ -0,0 +1,446 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"web-spider/internal/dedup"
+	"web-spider/internal/discovery"
+	"web-spider/internal/filter"
+	"web-spider/internal/frontier"
+	"web-spider/internal/models"
+	"web-spider/internal/parser"
+	"web-spider/internal/spider"
+	"web-spider/pkg/logger"
+)
+
+// Run crawls until the page threshold is reached, the frontier runs dry with no
+// crawl left in flight, or ctx is cancelled. With recrawls enabled an empty
+// frontier doesn't end the crawl, which then waits for pages due again.
+func (c *Crawler) Run(ctx context.Context) error {
+	// STATS SETUP
+	done := make(chan bool)
+	ticker := time.NewTicker(time.Second)
+
+	var checkpointTick <-chan time.Time
+	if c.diskFrontier != nil {
+		checkpointTicker := time.NewTicker(time.Duration(c.Config.Frontier.Checkpoint))
+		defer checkpointTicker.Stop()
+		checkpointTick = checkpointTicker.C
+	}
+	var recrawlTick <-chan time.Time
+	if c.Config.Recrawl.Enabled {
+		recrawlTicker := time.NewTicker(time.Duration(c.Config.Recrawl.Poll))
+		defer recrawlTicker.Stop()
+		recrawlTick = recrawlTicker.C
+	}
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case t := <-ticker.C:
+				c.Stats.CrawlingPerMinuteRate(c.Frontier, c.Seen, t)
+			case <-checkpointTick:
+				c.checkpoint()
+			case <-recrawlTick:
+				c.scheduleRevisits(ctx)
+			}
+		}
+	}()
+
+	// SEEDING CRAWLER
+	if err := c.seed(ctx); err != nil {
+		return err
+	}
+	if c.Config.Recrawl.Enabled {
+		c.scheduleRevisits(ctx)
+	}
+
+	if c.Config.Sequential {
+		c.runSequential(ctx)
+	} else {
+		c.runConcurrent(ctx)
+	}
+
+	logger.Info(fmt.Sprintf("\n\nTotal Procesed: `%d`\n\n", c.Frontier.TotalProcessedUrls()))
+	ticker.Stop()
+	if c.diskFrontier != nil {
+		c.checkpoint()
+	}
+	done <- true
+
+	c.printStats()
+	return nil
+}
+
+func (c *Crawler) runSequential(ctx context.Context) {
+	for ctx.Err() == nil && c.Frontier.TotalProcessedUrls() < c.Config.Limits.MaxPages {
+		item, ok := c.Frontier.Pop()
+		if !ok {
+			// WITH RECRAWLS ENABLED THE FRONTIER IS REFILLED BY scheduleRevisits
+			if !c.Config.Recrawl.Enabled {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		c.finish(ctx, item, c.crawlItem(ctx, item))
+	}
+}
+
+func (c *Crawler) runConcurrent(ctx context.Context) {
+	jobs := make(chan frontier.Item, 100)
+	done := make(chan bool)
+	// ITEMS HANDED TO THE WORKERS AND NOT FINISHED YET, THEY MAY STILL DISCOVER
+	// LINKS OR BE RETRIED
+	var inFlight atomic.Int64
+
+	// SPIN-UP WORKER GOROUTINES
+	for i := 0; i < c.Config.Workers; i++ {
+		go c.processUrl(ctx, i, jobs, &inFlight, done)
+	}
+
+	// GOROUTINE FEEDER (dispatcher goroutine)
+	go func() {
+		for {
+			if c.Frontier.TotalProcessedUrls() >= c.Config.Limits.MaxPages {
+				logger.Warn("🛑 Threshold reached.")
+				close(jobs)
+				return
+			}
+			if ctx.Err() != nil {
+				logger.Warn("🛑 Crawl interrupted.")
+				close(jobs)
+				return
+			}
+
+			// inFlight IS READ FIRST, A WORKER PUSHES ITS LINKS BEFORE IT IS DONE
+			if !c.Config.Recrawl.Enabled && inFlight.Load() == 0 && c.Frontier.Size() == 0 {
+				logger.Warn("🛑 Frontier exhausted.")
+				close(jobs)
+				return
+			}
+
+			item, ok := c.Frontier.TryPop()
+			if !ok {
+				logger.Info("Unsuccessful dequeue! Sleeping...")
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			logger.Info("Successful dequeue!")
+			inFlight.Add(1)
+			jobs <- item
+		}
+	}()
+
+	// Wait for all goroutines to finish.
+	for i := 0; i < c.Config.Workers; i++ {
+		<-done
+	}
+}
+
+func (c *Crawler) processUrl(ctx context.Context, id int, jobs chan frontier.Item, inFlight *atomic.Int64, done chan bool) {
+	defer logger.Info("Goroutine " + strconv.Itoa(id) + " finished.")
+	for item := range jobs {
+		c.finish(ctx, item, c.crawlItem(ctx, item))
+		inFlight.Add(-1)
+	}
+	done <- true
+}
+
+// crawlItem returns the fetch error, if any, so the url can be retried. Other
+// failures are final and only logged.
+func (c *Crawler) crawlItem(ctx context.Context, item frontier.Item) error {
+	stats := c.Stats
+
+	nUrl, err := filter.NormalizeUrl(item.Url)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	if !c.Robots.Allowed(ctx, nUrl) {
+		logger.Warn(fmt.Sprintf("Skipping: `%s` is disallowed by robots.txt.", nUrl))
+		stats.MU.Lock()
+		stats.SkippedDisallowed++
+		stats.MU.Unlock()
+		return nil
+	}
+
+	fmt.Println("Crawling: `" + nUrl + "` - Crawling count: " + strconv.Itoa(c.Seen.Size()))
+
+	// THE VERSION STORED BY A PREVIOUS CRAWL, IF ANY, TO REVALIDATE AND TO
+	// ADAPT THE REVISIT INTERVAL
+	previous := c.DB.PageState(nUrl)
+	var validators spider.Validators
+	if previous != nil && c.Config.HTTP.ConditionalRequests {
+		validators = spider.Validators{ETag: previous.ETag, LastModified: previous.LastModified}
+	}
+
+	redirectCheck := func(url string) error {
+		return c.Discovery.CheckRedirect(ctx, nUrl, url, item.Depth)
+	}
+	download, err := c.Fetcher.DownloadHTML(spider.WithRedirectCheck(ctx, redirectCheck), nUrl, validators, stats)
+	if errors.Is(err, spider.ErrNotModified) {
+		// ONLY A REVALIDATION OF A STORED PAGE MEANS IT IS UNCHANGED, A 304 TO
+		// AN UNCONDITIONAL REQUEST LEAVES NOTHING TO STORE
+		if previous == nil || validators == (spider.Validators{}) {
+			logger.Warn(fmt.Sprintf("Skipping: `%s` answered 304 to an unconditional request.", nUrl))
+			return nil
+		}
+		c.unchanged(ctx, nUrl, item.Depth, previous)
+		return nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	defer download.Close()
+
+	// A REDIRECTED PAGE IS STORED UNDER ITS FINAL URL
+	pageUrl := nUrl
+	if len(download.Redirects) > 0 {
+		finalUrl, err := filter.NormalizeUrl(download.FinalUrl)
+		if err == nil && finalUrl != nUrl {
+			if !c.Discovery.Redirected(download.Redirects, finalUrl) {
+				logger.Warn(fmt.Sprintf("Skipping: `%s` redirects to the already discovered `%s`.", nUrl, finalUrl))
+				return nil
+			}
+			pageUrl = finalUrl
+		}
+	}
+
+	// THE BODY IS STILL STREAMING, PARSE ERRORS ARE FETCH ERRORS
+	wp, err := parser.ParseHTML(pageUrl, download.Body, c.Parser)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	wp.StatusCode = download.StatusCode
+	wp.ContentType = download.ContentType
+	wp.Charset = download.Charset
+	wp.ContentLength = download.DecodedBytes()
+	wp.ResponseTime = download.ResponseTime
+	wp.Truncated = download.Truncated()
+	if pageUrl != nUrl {
+		wp.OriginalUrl = nUrl
+	}
+	wp.Redirects = download.Redirects
+	wp.ETag = download.ETag
+	wp.LastModified = download.LastModified
+	wp.FetchedAt = time.Now()
+	wp.LastCheckedAt = wp.FetchedAt
+	wp.Depth = item.Depth
+	changed := c.Recrawl.Schedule(wp, previous, wp.FetchedAt)
+
+	if wp.Title == "" {
+		logger.Warn(fmt.Sprintf("Skipping page without a title: %s\n", wp.Title))
+		return nil
+	}
+	if wp.Text == "" && len(wp.Links) == 0 {
+		logger.Warn(fmt.Sprintf("Skipping empty page: %s\n", wp.Url))
+		stats.MU.Lock()
+		stats.EmptyPages++
+		stats.MU.Unlock()
+		return nil
+	}
+
+	if previous != nil && previous.ContentHash != "" {
+		stats.MU.Lock()
+		if changed {
+			stats.ChangedPages++
+		} else {
+			stats.UnchangedPages++
+		}
+		stats.MU.Unlock()
+	}
+
+	// DUPLICATE CONTENT IS NEITHER STORED AGAIN NOR FOLLOWED, A PAGE STORED BY
+	// AN EARLIER CRAWL IS LINKED EVEN WITH THE skip POLICY SO THAT ITS NEXT
+	// VISIT STILL GETS RESCHEDULED
+	if c.Dedup != nil {
+		if match, ok := c.Dedup.Check(wp); ok {
+			c.countDuplicate(match)
+			if c.Config.Dedup.Policy == dedup.PolicySkip && previous == nil {
+				logger.Warn(fmt.Sprintf("Skipping: `%s` duplicates `%s`.", wp.Url, match.Url))
+				return nil
+			}
+			wp.DuplicateOf = match.Url
+			c.DB.UpsertWebPage(wp, stats)
+			return nil
+		}
+	}
+
+	c.DB.UpsertWebPage(wp, stats)
+	c.discoverLinks(ctx, wp.Links, item.Depth+1)
+
+	return nil
+}
+
+// unchanged records that the stored page of url was revalidated, pushing its
+// next visit further away, and follows its stored links so a refresh crawl
+// goes on past unchanged pages.
+func (c *Crawler) unchanged(ctx context.Context, url string, depth int, previous *models.WebPage) {
+	logger.Info(fmt.Sprintf("Unchanged since the last crawl: `%s`", url))
+	c.Stats.MU.Lock()
+	c.Stats.UnchangedPages++
+	c.Stats.MU.Unlock()
+
+	// A PAGE WITHOUT A STORED INTERVAL STARTS OVER FROM THE INITIAL ONE
+	var interval time.Duration
+	if previous != nil {
+		interval = previous.RevisitInterval
+	}
+	wp, err := c.DB.TouchWebPage(url, time.Now(), c.Recrawl.Next(interval, false))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to update the last check of `%s`: %v", url, err))
+		return
+	}
+	c.discoverLinks(ctx, wp.Links, depth+1)
+}
+
+func (c *Crawler) countDuplicate(match dedup.Match) {
+	c.Stats.MU.Lock()
+	defer c.Stats.MU.Unlock()
+	if match.Exact {
+		c.Stats.ExactDuplicates++
+	} else {
+		c.Stats.NearDuplicates++
+	}
+}
+
+// scheduleRevisits feeds the stored pages due for a recrawl into the frontier,
+// alongside the newly discovered urls.
+func (c *Crawler) scheduleRevisits(ctx context.Context) {
+	now := time.Now()
+	pages, err := c.DB.DuePages(now, c.Config.Recrawl.BatchSize)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to select pages due for a recrawl: %v", err))
+		return
+	}
+
+	for _, page := range pages {
+		// THE NEXT VISIT IS PUSHED BACK BEFORE THE RECRAWL, WHICH SCHEDULES IT
+		// AGAIN ONCE IT SUCCEEDS, SO A PAGE THAT FAILS OR IS SKIPPED DOESN'T
+		// COME BACK FIRST IN EVERY BATCH
+		next := now.Add(c.Recrawl.Backoff(page.LastCheckedAt, now))
+		claimed, err := c.DB.PostponeVisit(page.Url, page.NextVisitAt, next)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to postpone the next visit of `%s`: %v", page.Url, err))
+			continue
+		}
+		// ANOTHER PROCESS PICKED THE PAGE FIRST
+		if !claimed {
+			continue
+		}
+		if errors.Is(c.Discovery.Revisit(ctx, page.Url, page.Depth), discovery.ErrLimitReached) {
+			break
+		}
+	}
+}
+
+// discoverLinks follows the links of a page, except the nofollow ones.
+func (c *Crawler) discoverLinks(ctx context.Context, links []models.Link, depth int) {
+	for _, link := range links {
+		if link.Nofollow {
+			continue
+		}
+		if errors.Is(c.Discovery.Discover(ctx, link.Url, depth), discovery.ErrLimitReached) {
+			break
+		}
+	}
+}
+
+// finish completes a crawled url, or puts it back in the frontier when its
+// fetch failed transiently and the retry policy allows another attempt.
+func (c *Crawler) finish(ctx context.Context, item frontier.Item, err error) {
+	if err == nil || ctx.Err() != nil {
+		c.Discovery.Complete(item.Url)
+		return
+	}
+
+	attempt := item.Attempts + 1
+	delay, ok := c.RetryPolicy.Next(err, attempt)
+	if !ok {
+		if spider.Retryable(err) {
+			c.Stats.MU.Lock()
+			c.Stats.RetriesExhausted++
+			c.Stats.MU.Unlock()
+		}
+		c.Discovery.Complete(item.Url)
+		return
+	}
+
+	c.Stats.MU.Lock()
+	c.Stats.Retries[spider.StatusCode(err)]++
+	c.Stats.MU.Unlock()
+
+	logger.Warn(fmt.Sprintf("Retrying `%s` in %v (attempt %d of %d).", item.Url, delay.Round(time.Millisecond), attempt+1, c.RetryPolicy.MaxAttempts))
+	item.Attempts = attempt
+	item.NotBefore = time.Now().Add(delay)
+	c.Discovery.Retry(item)
+}
+
+func (c *Crawler) seed(ctx context.Context) error {
+	if c.Config.Frontier.Resume && c.Frontier.Size() > 0 {
+		logger.Info(fmt.Sprintf("Resuming crawl with %d queued and %d seen URLs.", c.Frontier.Size(), c.Seen.Size()))
+		c.Stats.TotalSeen = c.Seen.Size()
+		c.Stats.UniqueEnqueued = c.Seen.Size()
+		return nil
+	}
+
+	seeds, err := c.Config.AllSeeds()
+	if err != nil {
+		return err
+	}
+	for _, seed := range seeds {
+		if err = c.Discovery.Discover(ctx, seed, 0); err != nil {
+			logger.Warn(fmt.Sprintf("Skipping seed `%s`: %v", seed, err))
+		}
+	}
+
+	return nil
+}
+
+func (c *Crawler) printStats() {
+	stats := c.Stats
+	logger.Info(fmt.Sprintf("Raw Stats → TotalSeen: %d, UniqueEnqueued: %d, DBInserted: %d, DBInsertAttempts: %d, FailedInserts: %d, HTMLPages: %d, EmptyPages: %d, SkippedDuplicates: %d, SkippedDisallowed: %d, HTTPErrors: %d, RedirectedPages: %d, NotModifiedPages: %d, RevisitedPages: %d, ChangedPages: %d, UnchangedPages: %d, ExactDuplicates: %d, NearDuplicates: %d, TruncatedPages: %d, OversizedPages: %d, CompressedPages: %d, CompressionBombs: %d, WireBytes: %d, DecodedBytes: %d",
+		stats.TotalSeen,
+		stats.UniqueEnqueued,
+		stats.DBInserted,
+		stats.DBInsertAttempts,
+		stats.FailedInserts,
+		stats.HTMLPages,
+		stats.EmptyPages,
+		stats.SkippedDuplicates,
+		stats.SkippedDisallowed,
+		stats.HTTPErrors,
+		stats.RedirectedPages,
+		stats.NotModifiedPages,
+		stats.RevisitedPages,
+		stats.ChangedPages,
+		stats.UnchangedPages,
+		stats.ExactDuplicates,
+		stats.NearDuplicates,
+		stats.TruncatedPages,
+		stats.OversizedPages,
+		stats.CompressedPages,
+		stats.CompressionBombs,
+		stats.WireBytes,
+		stats.DecodedBytes,
+	))
+	stats.PrintTimingStats()
+	stats.PrintGeneralStats()
+	stats.PrintScopeStats()
+	stats.PrintRetryStats()
+	stats.PrintDedupStats()
+	stats.PrintRecrawlStats()
+	stats.PrintSeenSetStats(c.Seen)
+	fmt.Printf("\n\nProgram Finished. It took: %v\n\n", time.Since(stats.StartedAt))
+}
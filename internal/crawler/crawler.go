@@ -0,0 +1,195 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/joho/godotenv"
+	"path/filepath"
+	"runtime"
+	"time"
+	"web-spider/internal/config"
+	"web-spider/internal/database/mongodb"
+	"web-spider/internal/dedup"
+	"web-spider/internal/discovery"
+	"web-spider/internal/filter"
+	"web-spider/internal/frontier"
+	"web-spider/internal/metrics"
+	"web-spider/internal/parser"
+	"web-spider/internal/recrawl"
+	"web-spider/internal/robots"
+	"web-spider/internal/scope"
+	"web-spider/internal/spider"
+	"web-spider/pkg/logger"
+)
+
+// Crawler holds everything a crawl needs, set up once for both the sequential
+// and the concurrent crawl loops.
+type Crawler struct {
+	Config       *config.Config
+	DB           *mongodb.DatabaseConnection
+	Frontier     frontier.URLFrontier
+	Seen         filter.SeenSet
+	Fetcher      *spider.Fetcher
+	RetryPolicy  spider.RetryPolicy
+	Recrawl      recrawl.Policy
+	Parser       parser.Options
+	Dedup        *dedup.Index
+	Robots       *robots.Checker
+	Discovery    *discovery.Pipeline
+	Stats        *metrics.CrawlerStats
+	diskFrontier *frontier.DiskFrontier
+	seenPath     string
+}
+
+func New(cfg *config.Config) (*Crawler, error) {
+	if cfg.MaxProcs > 0 {
+		runtime.GOMAXPROCS(cfg.MaxProcs)
+	}
+	logger.Info(fmt.Sprintf("GOMAXPROCS: %d", runtime.GOMAXPROCS(0)))
+
+	fetcher, err := spider.NewFetcher(cfg.FetcherOptions())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Normalization != "" {
+		rules, err := filter.LoadNormalizationRules(cfg.Normalization)
+		if err != nil {
+			return nil, err
+		}
+		filter.SetNormalizer(filter.NewNormalizer(rules))
+	}
+
+	crawlScope, err := scope.New(cfg.ScopeRules())
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := connectDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	crawler := &Crawler{
+		Config:      cfg,
+		DB:          db,
+		Fetcher:     fetcher,
+		RetryPolicy: cfg.RetryPolicy(),
+		Recrawl:     cfg.RecrawlPolicy(),
+		Parser:      cfg.ParserOptions(),
+		Robots:      robots.NewChecker(cfg.UserAgent, time.Duration(cfg.Politeness.RobotsTTL)),
+		Stats:       metrics.NewCrawlerStats(),
+		seenPath:    filepath.Join(cfg.Frontier.DataDir, "seen.bin"),
+	}
+	crawler.Robots.Client = fetcher.Client
+	if cfg.Dedup.Policy != dedup.PolicyOff {
+		crawler.Dedup = dedup.New(cfg.Dedup.MaxDistance)
+		// PAGES STORED BY EARLIER CRAWLS OR OTHER PROCESSES ARE ORIGINALS TOO
+		if err = db.EachFingerprint(crawler.Dedup.Add); err != nil {
+			db.Disconnect()
+			return nil, err
+		}
+	}
+	if err = crawler.setupStructures(); err != nil {
+		db.Disconnect()
+		return nil, err
+	}
+
+	crawler.Discovery = discovery.NewPipeline(crawler.Seen, crawler.Frontier, crawler.Robots, crawler.Stats, cfg.EffectiveEnqueueLimit())
+	crawler.Discovery.Scope = crawlScope
+
+	return crawler, nil
+}
+
+func (c *Crawler) Close() {
+	if c.diskFrontier != nil {
+		if err := c.diskFrontier.Close(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to close frontier journal: %v", err))
+		}
+	}
+	c.DB.Disconnect()
+}
+
+func (c *Crawler) setupStructures() error {
+	cfg := c.Config
+
+	prioritizer, err := frontier.NewPrioritizer(cfg.Frontier.Priority, cfg.Frontier.PriorityRules)
+	if err != nil {
+		return err
+	}
+	memFrontier := frontier.NewFrontier(time.Duration(cfg.Politeness.Delay), prioritizer)
+
+	switch cfg.SeenSet.Kind {
+	case "map":
+		c.Seen = &filter.UrlSet{Set: make(map[uint64]bool, 1000)}
+	case "bloom":
+		c.Seen, err = filter.NewScalableBloomFilter(1000, cfg.SeenSet.FPRate)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown seen set `%s`", cfg.SeenSet.Kind)
+	}
+
+	// PERSISTENCE SETUP
+	switch cfg.Frontier.Kind {
+	case "memory":
+		c.Frontier = memFrontier
+	case "disk":
+		if cfg.Frontier.Resume {
+			if err = c.Seen.Load(c.seenPath); err != nil {
+				return err
+			}
+		}
+		c.diskFrontier, err = frontier.OpenDiskFrontier(cfg.Frontier.DataDir, memFrontier, cfg.Frontier.Resume, c.Seen.Add)
+		if err != nil {
+			return err
+		}
+		c.Frontier = c.diskFrontier
+		c.checkpoint()
+	case "mongo":
+		c.Frontier, err = mongodb.NewFrontier(c.DB.FrontierCollection(), time.Duration(cfg.Politeness.Delay), time.Duration(cfg.Frontier.Lease), prioritizer)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown frontier `%s`", cfg.Frontier.Kind)
+	}
+
+	return nil
+}
+
+// checkpoint compacts the frontier journal, then saves the seen set: the urls
+// the compaction drops were all added to the seen set before it.
+func (c *Crawler) checkpoint() {
+	if err := c.diskFrontier.Compact(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to compact frontier journal: %v", err))
+	}
+	if err := c.Seen.Save(c.seenPath); err != nil {
+		logger.Error(fmt.Sprintf("Failed to checkpoint seen set: %v", err))
+	}
+}
+
+func connectDatabase(cfg *config.Config) (*mongodb.DatabaseConnection, error) {
+	// DATABASE SETUP
+	dbAccess := true
+	if err := godotenv.Load(cfg.EnvFile()); err != nil {
+		logger.Error("Error loading " + cfg.EnvFile() + " file. Preventing access to crawler dataset.")
+		dbAccess = false
+	}
+
+	dbConnection := &mongodb.DatabaseConnection{
+		IsAccessible: dbAccess,
+		Uri:          "",
+		Client:       nil,
+		Collection:   nil,
+	}
+
+	if !dbConnection.IsAccessible {
+		return nil, errors.New("database is not accessible, halting crawler")
+	}
+	dbConnection.Connect()
+
+	dbConnection.EnsureIndexes()
+
+	return dbConnection, nil
+}
@@ -0,0 +1,389 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	url2 "net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"web-spider/internal/frontier"
+	"web-spider/pkg/logger"
+)
+
+const (
+	stateQueued = "queued"
+	stateLeased = "leased"
+	stateDone   = "done"
+)
+
+type frontierDoc struct {
+	Url         string    `bson:"_id"`
+	Host        string    `bson:"host"`
+	Depth       int       `bson:"depth"`
+	Priority    float64   `bson:"priority"`
+	State       string    `bson:"state"`
+	Owner       string    `bson:"owner,omitempty"`
+	LeaseUntil  time.Time `bson:"leaseUntil,omitempty"`
+	Attempts    int       `bson:"attempts"`
+	Retries     int       `bson:"retries"`
+	NotBefore   time.Time `bson:"notBefore,omitempty"`
+	EnqueuedAt  time.Time `bson:"enqueuedAt"`
+	CompletedAt time.Time `bson:"completedAt,omitempty"`
+}
+
+// hostDoc is the politeness state of a host shared by all processes: no url
+// of the host is claimed before NextAt, and CrawlDelayMs overrides the
+// default delay when set.
+type hostDoc struct {
+	Host         string    `bson:"_id"`
+	NextAt       time.Time `bson:"nextAt"`
+	CrawlDelayMs int64     `bson:"crawlDelayMs,omitempty"`
+}
+
+// Frontier is a URL frontier shared by several crawler processes. Urls are
+// claimed with a lease, so a url claimed by a crashed process becomes
+// available again once its lease expires. Politeness is coordinated across
+// processes through the Hosts collection, a host being reserved until its
+// next allowed request every time one of its urls is claimed.
+type Frontier struct {
+	Collection  *mongo.Collection
+	Hosts       *mongo.Collection
+	Owner       string
+	Delay       time.Duration
+	Lease       time.Duration
+	Prioritizer frontier.Prioritizer
+	crawlDelays map[string]time.Duration
+	mu          sync.Mutex
+}
+
+func (db *DatabaseConnection) FrontierCollection() *mongo.Collection {
+	name := os.Getenv("MONGO_FRONTIER_COLLECTION")
+	if name == "" {
+		name = "frontier"
+	}
+	return db.Client.Database(os.Getenv("MONGO_DATABASE")).Collection(name)
+}
+
+// NewFrontier opens the shared frontier stored in collection, along with the
+// `<collection>_hosts` collection holding the hosts' politeness state.
+func NewFrontier(collection *mongo.Collection, delay, lease time.Duration, prioritizer frontier.Prioritizer) (*Frontier, error) {
+	if prioritizer == nil {
+		prioritizer = frontier.FIFOPrioritizer{}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	f := &Frontier{
+		Collection:  collection,
+		Hosts:       collection.Database().Collection(collection.Name() + "_hosts"),
+		Owner:       fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		Delay:       delay,
+		Lease:       lease,
+		Prioritizer: prioritizer,
+		crawlDelays: make(map[string]time.Duration),
+	}
+
+	claimIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "state", Value: 1}, {Key: "priority", Value: -1}, {Key: "enqueuedAt", Value: 1}},
+		Options: options.Index().SetName("ClaimIndex"),
+	}
+	leaseIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "state", Value: 1}, {Key: "leaseUntil", Value: 1}},
+		Options: options.Index().SetName("LeaseIndex"),
+	}
+	_, err = collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{claimIdx, leaseIdx})
+	if err != nil {
+		return nil, err
+	}
+
+	nextAtIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "nextAt", Value: 1}},
+		Options: options.Index().SetName("NextAtIndex"),
+	}
+	if _, err = f.Hosts.Indexes().CreateOne(context.TODO(), nextAtIdx); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *Frontier) Push(item frontier.Item) {
+	doc := frontierDoc{
+		Url:        item.Url,
+		Host:       hostOf(item.Url),
+		Depth:      item.Depth,
+		Priority:   f.Prioritizer.Priority(item),
+		State:      stateQueued,
+		Retries:    item.Attempts,
+		NotBefore:  item.NotBefore,
+		EnqueuedAt: time.Now(),
+	}
+
+	// UPSERTING ON THE URL KEEPS A URL FROM BEING QUEUED TWICE ACROSS PROCESSES
+	_, err := f.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": item.Url},
+		bson.M{"$setOnInsert": doc},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		logger.Error(fmt.Sprintf("Failed to push `%s` to the shared frontier: %v", item.Url, err))
+	}
+}
+
+// Pop polls for a claimable url, it reports false once no url is queued.
+func (f *Frontier) Pop() (frontier.Item, bool) {
+	for {
+		if item, ok := f.TryPop(); ok {
+			return item, true
+		}
+		if f.Size() == 0 {
+			return frontier.Item{}, false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// TryPop claims the best url whose host may be requested now, and reserves
+// the host until its politeness delay has passed.
+func (f *Frontier) TryPop() (frontier.Item, bool) {
+	now := time.Now()
+	busy, err := f.busyHosts(now)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to read the shared frontier's hosts: %v", err))
+		return frontier.Item{}, false
+	}
+
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"state": stateQueued, "notBefore": bson.M{"$not": bson.M{"$gt": now}}},
+			bson.M{"state": stateLeased, "leaseUntil": bson.M{"$lt": now}},
+		},
+		"host": bson.M{"$nin": busy},
+	}
+	update := bson.M{
+		"$set": bson.M{"state": stateLeased, "owner": f.Owner, "leaseUntil": now.Add(f.Lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "enqueuedAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var doc frontierDoc
+	err = f.Collection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&doc)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Error(fmt.Sprintf("Failed to claim a url from the shared frontier: %v", err))
+		}
+		return frontier.Item{}, false
+	}
+
+	// ANOTHER PROCESS MAY HAVE RESERVED THE HOST SINCE busyHosts, THE CLAIM IS
+	// THEN GIVEN UP
+	if !f.reserveHost(hostOf(doc.Url), now) {
+		f.release(doc.Url)
+		return frontier.Item{}, false
+	}
+
+	return frontier.Item{Url: doc.Url, Depth: doc.Depth, Attempts: doc.Retries}, true
+}
+
+// busyHosts returns the hosts that can't be requested before a later time.
+func (f *Frontier) busyHosts(now time.Time) (bson.A, error) {
+	cursor, err := f.Hosts.Find(
+		context.TODO(),
+		bson.M{"nextAt": bson.M{"$gt": now}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var docs []hostDoc
+	if err = cursor.All(context.TODO(), &docs); err != nil {
+		return nil, err
+	}
+
+	busy := bson.A{}
+	for _, doc := range docs {
+		busy = append(busy, doc.Host)
+	}
+	return busy, nil
+}
+
+// reserveHost moves the next allowed request time of a host past its delay,
+// unless the host is still reserved, in which case it reports false.
+func (f *Frontier) reserveHost(host string, now time.Time) bool {
+	// THE DELAY IS READ IN THE SAME UPDATE SO THAT A Crawl-delay SET BY ANY
+	// PROCESS APPLIES
+	update := bson.A{bson.M{"$set": bson.M{
+		"nextAt": bson.M{"$add": bson.A{now, bson.M{"$ifNull": bson.A{"$crawlDelayMs", f.Delay.Milliseconds()}}}},
+	}}}
+	_, err := f.Hosts.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": host, "nextAt": bson.M{"$not": bson.M{"$gt": now}}},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		// A DUPLICATE KEY MEANS THE HOST EXISTS AND IS STILL RESERVED
+		if !mongo.IsDuplicateKeyError(err) {
+			logger.Error(fmt.Sprintf("Failed to reserve `%s` in the shared frontier: %v", host, err))
+		}
+		return false
+	}
+	return true
+}
+
+// release gives up a claim that was not crawled, the attempt not counting.
+func (f *Frontier) release(url string) {
+	_, err := f.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": url, "owner": f.Owner},
+		bson.M{
+			"$set":   bson.M{"state": stateQueued},
+			"$unset": bson.M{"owner": "", "leaseUntil": ""},
+			"$inc":   bson.M{"attempts": -1},
+		},
+	)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to release `%s` in the shared frontier: %v", url, err))
+	}
+}
+
+// Retry releases a claimed url back to the queue, claimable again once its
+// NotBefore time has passed.
+func (f *Frontier) Retry(item frontier.Item) {
+	_, err := f.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": item.Url, "owner": f.Owner},
+		bson.M{
+			"$set": bson.M{
+				"state":     stateQueued,
+				"retries":   item.Attempts,
+				"notBefore": item.NotBefore,
+				"priority":  f.Prioritizer.Priority(item),
+			},
+			"$unset": bson.M{"owner": "", "leaseUntil": ""},
+		},
+	)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to put `%s` back in the shared frontier: %v", item.Url, err))
+	}
+}
+
+// Revisit queues again a url done in an earlier crawl. Push leaves done urls
+// alone so that no process crawls a url twice in the same crawl.
+func (f *Frontier) Revisit(item frontier.Item) {
+	_, err := f.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": item.Url, "state": stateDone},
+		bson.M{
+			"$set": bson.M{
+				"host":       hostOf(item.Url),
+				"depth":      item.Depth,
+				"priority":   f.Prioritizer.Priority(item),
+				"state":      stateQueued,
+				"retries":    0,
+				"enqueuedAt": time.Now(),
+			},
+			"$unset": bson.M{"owner": "", "leaseUntil": "", "notBefore": "", "completedAt": ""},
+		},
+		options.Update().SetUpsert(true),
+	)
+	// A DUPLICATE KEY MEANS THE url IS ALREADY QUEUED OR LEASED
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		logger.Error(fmt.Sprintf("Failed to requeue `%s` in the shared frontier: %v", item.Url, err))
+	}
+}
+
+func (f *Frontier) Complete(url string) {
+	_, err := f.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": url, "owner": f.Owner},
+		bson.M{
+			"$set":   bson.M{"state": stateDone, "completedAt": time.Now()},
+			"$unset": bson.M{"leaseUntil": ""},
+		},
+	)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to complete `%s` in the shared frontier: %v", url, err))
+	}
+}
+
+func (f *Frontier) ObserveLink(url string) {
+	observer, ok := f.Prioritizer.(frontier.LinkObserver)
+	if !ok {
+		return
+	}
+	observer.ObserveLink(url)
+
+	_, err := f.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": url, "state": stateQueued},
+		bson.M{"$set": bson.M{"priority": f.Prioritizer.Priority(frontier.Item{Url: url})}},
+	)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to re-score `%s` in the shared frontier: %v", url, err))
+	}
+}
+
+// SetCrawlDelay overrides the default politeness delay for the host of the
+// given URL, for every process sharing the frontier.
+func (f *Frontier) SetCrawlDelay(url string, delay time.Duration) {
+	host := hostOf(url)
+	// EVERY LINK TO THE HOST SETS IT AGAIN, ONLY A CHANGE IS WRITTEN
+	f.mu.Lock()
+	known := f.crawlDelays[host] == delay
+	f.crawlDelays[host] = delay
+	f.mu.Unlock()
+	if known {
+		return
+	}
+
+	_, err := f.Hosts.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": host},
+		bson.M{
+			"$set":         bson.M{"crawlDelayMs": delay.Milliseconds()},
+			"$setOnInsert": bson.M{"nextAt": time.Time{}},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to set the crawl delay of `%s` in the shared frontier: %v", host, err))
+	}
+}
+
+func (f *Frontier) Size() int {
+	return f.count(bson.M{"state": stateQueued})
+}
+
+func (f *Frontier) TotalProcessedUrls() int {
+	return f.count(bson.M{"state": bson.M{"$in": bson.A{stateLeased, stateDone}}})
+}
+
+func (f *Frontier) count(filter bson.M) int {
+	n, err := f.Collection.CountDocuments(context.TODO(), filter)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to count the shared frontier: %v", err))
+		return 0
+	}
+	return int(n)
+}
+
+func hostOf(url string) string {
+	u, err := url2.Parse(url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -2,10 +2,13 @@ package mongodb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"os"
+	"time"
 	"web-spider/internal/metrics"
 	"web-spider/internal/models"
 	"web-spider/pkg/logger"
@@ -40,7 +43,81 @@ func (db *DatabaseConnection) Disconnect() {
 	}
 }
 
-func (db *DatabaseConnection) InsertWebPage(wp *models.WebPage, stats *metrics.CrawlerStats) bool {
+// Index option and key conflicts, raised when an index is redefined under the
+// same name.
+const (
+	indexOptionsConflict  = 85
+	indexKeySpecsConflict = 86
+)
+
+func (db *DatabaseConnection) EnsureIndexes() {
+	// THE SEARCH INDEX RANKS TITLE AND HEADING MATCHES ABOVE BODY TEXT ONES
+	textIdx := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "title", Value: "text"},
+			{Key: "description", Value: "text"},
+			{Key: "headings.h1", Value: "text"},
+			{Key: "headings.h2", Value: "text"},
+			{Key: "headings.h3", Value: "text"},
+			{Key: "text", Value: "text"},
+		},
+		Options: options.Index().SetName("TextIndex").SetWeights(bson.D{
+			{Key: "title", Value: 10},
+			{Key: "description", Value: 5},
+			{Key: "headings.h1", Value: 5},
+			{Key: "headings.h2", Value: 3},
+			{Key: "headings.h3", Value: 2},
+			{Key: "text", Value: 1},
+		}),
+	}
+	urlIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "url", Value: 1}},
+		Options: options.Index().SetName("UrlIndex"),
+	}
+	originalUrlIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "originalUrl", Value: 1}},
+		Options: options.Index().SetName("OriginalUrlIndex").SetSparse(true),
+	}
+	nextVisitIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "nextVisitAt", Value: 1}},
+		Options: options.Index().SetName("NextVisitIndex").SetSparse(true),
+	}
+	langIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "lang", Value: 1}},
+		Options: options.Index().SetName("LangIndex").SetSparse(true),
+	}
+	structuredTypeIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "structuredData.@type", Value: 1}},
+		Options: options.Index().SetName("StructuredTypeIndex").SetSparse(true),
+	}
+	// THE LINK GRAPH IS WALKED BACKWARDS BY TARGET URL
+	linkUrlIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "links.url", Value: 1}},
+		Options: options.Index().SetName("LinkUrlIndex"),
+	}
+	fetchedAtIdx := mongo.IndexModel{
+		Keys:    bson.D{{Key: "fetchedAt", Value: -1}},
+		Options: options.Index().SetName("FetchedAtIndex"),
+	}
+	for _, idx := range []mongo.IndexModel{textIdx, urlIdx, originalUrlIdx, nextVisitIdx, langIdx, structuredTypeIdx, linkUrlIdx, fetchedAtIdx} {
+		_, err := db.Collection.Indexes().CreateOne(context.TODO(), idx)
+		// AN INDEX CREATED BY AN OLDER VERSION UNDER THE SAME NAME IS REPLACED
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.Code == indexOptionsConflict || cmdErr.Code == indexKeySpecsConflict) {
+			name := *idx.Options.Name
+			logger.Warn(fmt.Sprintf("Replacing the outdated `%s` index.", name))
+			if _, err = db.Collection.Indexes().DropOne(context.TODO(), name); err == nil {
+				_, err = db.Collection.Indexes().CreateOne(context.TODO(), idx)
+			}
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// UpsertWebPage stores a page, replacing the previous crawl of the same url.
+func (db *DatabaseConnection) UpsertWebPage(wp *models.WebPage, stats *metrics.CrawlerStats) bool {
 	stats.MU.Lock()
 	stats.DBInsertAttempts++
 	stats.MU.Unlock()
@@ -53,20 +130,20 @@ func (db *DatabaseConnection) InsertWebPage(wp *models.WebPage, stats *metrics.C
 			return false
 		}
 
-		result, err := db.Collection.InsertOne(context.Background(), wp)
+		result, err := db.Collection.ReplaceOne(context.Background(), bson.M{"url": wp.Url}, wp, options.Replace().SetUpsert(true))
 		if err != nil {
-			if mongo.IsDuplicateKeyError(err) {
-				logger.Error("Duplicate URL skipped: " + wp.Url)
-			} else {
-				logger.Error(fmt.Sprintf("Failed to insert page: %v\n", err))
-			}
+			logger.Error(fmt.Sprintf("Failed to upsert page: %v\n", err))
 			stats.MU.Lock()
 			stats.FailedInserts++
 			stats.MU.Unlock()
 			return false
 		}
 
-		logger.Success(fmt.Sprintf("Inserted URL with _id: %s\n", result.InsertedID))
+		if result.UpsertedID != nil {
+			logger.Success(fmt.Sprintf("Inserted URL with _id: %s\n", result.UpsertedID))
+		} else {
+			logger.Success(fmt.Sprintf("Updated URL: %s\n", wp.Url))
+		}
 		stats.MU.Lock()
 		stats.DBInserted++
 		stats.MU.Unlock()
@@ -77,3 +154,115 @@ func (db *DatabaseConnection) InsertWebPage(wp *models.WebPage, stats *metrics.C
 	stats.MU.Unlock()
 	return false
 }
+
+// PageState returns the validators and revisit schedule stored with the last
+// crawl of url, found either under its own url or as the original url of a
+// redirect, nil if url was never stored.
+func (db *DatabaseConnection) PageState(url string) *models.WebPage {
+	if !db.IsAccessible || db.Collection == nil {
+		return nil
+	}
+	var page models.WebPage
+	opts := options.FindOne().SetProjection(bson.M{"etag": 1, "lastModified": 1, "contentHash": 1, "revisitInterval": 1})
+	err := db.Collection.FindOne(context.TODO(), pageFilter(url), opts).Decode(&page)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Error(fmt.Sprintf("Failed to look up the stored state of `%s`: %v", url, err))
+		}
+		return nil
+	}
+	return &page
+}
+
+// DuePages returns up to limit stored pages whose next visit time has passed,
+// the most overdue first.
+func (db *DatabaseConnection) DuePages(now time.Time, limit int) ([]models.WebPage, error) {
+	if !db.IsAccessible || db.Collection == nil {
+		return nil, errors.New("mongo database is not accessible")
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "nextVisitAt", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"url": 1, "depth": 1, "lastCheckedAt": 1, "nextVisitAt": 1})
+	cursor, err := db.Collection.Find(context.TODO(), bson.M{"nextVisitAt": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []models.WebPage
+	if err = cursor.All(context.TODO(), &pages); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// PostponeVisit moves the next visit of url from due to next, unless another
+// process did it first. It reports whether the visit was moved.
+func (db *DatabaseConnection) PostponeVisit(url string, due, next time.Time) (bool, error) {
+	if !db.IsAccessible || db.Collection == nil {
+		return false, errors.New("mongo database is not accessible")
+	}
+	result, err := db.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"$and": bson.A{pageFilter(url), bson.M{"nextVisitAt": due}}},
+		bson.M{"$set": bson.M{"nextVisitAt": next}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// EachFingerprint calls fn with the url, text hash and SimHash of every stored
+// page that isn't a duplicate, to seed the dedup index.
+func (db *DatabaseConnection) EachFingerprint(fn func(wp *models.WebPage)) error {
+	if !db.IsAccessible || db.Collection == nil {
+		return errors.New("mongo database is not accessible")
+	}
+	filter := bson.M{
+		"textHash":    bson.M{"$exists": true},
+		"duplicateOf": bson.M{"$exists": false},
+	}
+	opts := options.Find().SetProjection(bson.M{"url": 1, "textHash": 1, "simHash": 1})
+	cursor, err := db.Collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var page models.WebPage
+		if err = cursor.Decode(&page); err != nil {
+			return err
+		}
+		fn(&page)
+	}
+	return cursor.Err()
+}
+
+// TouchWebPage records that url was checked and found unchanged, schedules its
+// next visit after interval, and returns the stored page.
+func (db *DatabaseConnection) TouchWebPage(url string, checkedAt time.Time, interval time.Duration) (*models.WebPage, error) {
+	if !db.IsAccessible || db.Collection == nil {
+		return nil, errors.New("mongo database is not accessible")
+	}
+	var page models.WebPage
+	err := db.Collection.FindOneAndUpdate(
+		context.TODO(),
+		pageFilter(url),
+		bson.M{"$set": bson.M{
+			"lastCheckedAt":   checkedAt,
+			"revisitInterval": interval,
+			"nextVisitAt":     checkedAt.Add(interval),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func pageFilter(url string) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"url": url}, bson.M{"originalUrl": url}}}
+}
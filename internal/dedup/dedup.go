@@ -0,0 +1,152 @@
+package dedup
+
+import (
+	"slices"
+	"sync"
+	"web-spider/internal/fingerprint"
+	"web-spider/internal/models"
+)
+
+const (
+	PolicyOff  = "off"
+	PolicySkip = "skip"
+	PolicyLink = "link"
+)
+
+// MaxDistanceLimit keeps the SimHash bands at least 4 bits wide.
+const MaxDistanceLimit = 15
+
+// Match is the earlier page a crawled page duplicates.
+type Match struct {
+	Url      string
+	Exact    bool
+	Distance int
+}
+
+type entry struct {
+	url     string
+	simHash uint64
+}
+
+type fingerprints struct {
+	textHash string
+	simHash  uint64
+}
+
+// Index remembers the fingerprints of the pages kept during a crawl, one per
+// url. Exact duplicates are found by text hash. For near-duplicates, SimHashes
+// are cut into MaxDistance+1 bands: two hashes at most MaxDistance bits apart
+// share at least one band, so a page is only compared with the pages sharing
+// a band.
+type Index struct {
+	MaxDistance int
+	exact       map[string]string
+	bands       []map[uint64][]entry
+	pages       map[string]fingerprints
+	mu          sync.Mutex
+}
+
+func New(maxDistance int) *Index {
+	bands := make([]map[uint64][]entry, maxDistance+1)
+	for i := range bands {
+		bands[i] = make(map[uint64][]entry)
+	}
+	return &Index{
+		MaxDistance: maxDistance,
+		exact:       make(map[string]string),
+		bands:       bands,
+		pages:       make(map[string]fingerprints),
+	}
+}
+
+// Add indexes a page kept earlier without checking it, e.g. one stored by a
+// previous crawl.
+func (x *Index) Add(wp *models.WebPage) {
+	simHash, err := fingerprint.Parse(wp.SimHash)
+	if wp.TextHash == "" || err != nil {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(wp.Url)
+	x.add(wp.Url, wp.TextHash, simHash)
+}
+
+// Check returns the earlier page wp duplicates, if any, and otherwise adds wp
+// to the index. Either way the fingerprint of an earlier crawl of the same url
+// is dropped. Pages without text are never duplicates.
+func (x *Index) Check(wp *models.WebPage) (Match, bool) {
+	if wp.Text == "" {
+		return Match{}, false
+	}
+	simHash, err := fingerprint.Parse(wp.SimHash)
+	if err != nil {
+		return Match{}, false
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	// A RECRAWLED PAGE REPLACES ITS EARLIER FINGERPRINT, WHICH IT CAN'T DUPLICATE
+	x.remove(wp.Url)
+
+	if url, ok := x.exact[wp.TextHash]; ok {
+		return Match{Url: url, Exact: true}, true
+	}
+
+	keys := x.bandKeys(simHash)
+	for i, key := range keys {
+		for _, e := range x.bands[i][key] {
+			if d := fingerprint.Distance(simHash, e.simHash); d <= x.MaxDistance {
+				return Match{Url: e.url, Distance: d}, true
+			}
+		}
+	}
+
+	x.add(wp.Url, wp.TextHash, simHash)
+	return Match{}, false
+}
+
+func (x *Index) add(url, textHash string, simHash uint64) {
+	if _, ok := x.exact[textHash]; !ok {
+		x.exact[textHash] = url
+	}
+	for i, key := range x.bandKeys(simHash) {
+		x.bands[i][key] = append(x.bands[i][key], entry{url: url, simHash: simHash})
+	}
+	x.pages[url] = fingerprints{textHash: textHash, simHash: simHash}
+}
+
+// remove forgets the fingerprint indexed for url, if any.
+func (x *Index) remove(url string) {
+	page, ok := x.pages[url]
+	if !ok {
+		return
+	}
+	delete(x.pages, url)
+
+	if x.exact[page.textHash] == url {
+		delete(x.exact, page.textHash)
+	}
+	for i, key := range x.bandKeys(page.simHash) {
+		x.bands[i][key] = slices.DeleteFunc(x.bands[i][key], func(e entry) bool { return e.url == url })
+		if len(x.bands[i][key]) == 0 {
+			delete(x.bands[i], key)
+		}
+	}
+}
+
+func (x *Index) bandKeys(simHash uint64) []uint64 {
+	n := len(x.bands)
+	keys := make([]uint64, n)
+	for i := range keys {
+		from, to := i*64/n, (i+1)*64/n
+		mask := ^uint64(0)
+		if to-from < 64 {
+			mask = 1<<(to-from) - 1
+		}
+		keys[i] = simHash >> from & mask
+	}
+	return keys
+}
@@ -0,0 +1,100 @@
+package dedup
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"web-spider/internal/fingerprint"
+	"web-spider/internal/models"
+)
+
+func page(url, text string) *models.WebPage {
+	return &models.WebPage{
+		Url:      url,
+		Text:     text,
+		TextHash: fingerprint.TextHash(text),
+		SimHash:  fingerprint.Format(fingerprint.SimHash(text)),
+	}
+}
+
+var (
+	article = words(0, 200)
+	edited  = words(0, 199) + " changed"
+	other   = words(1000, 1200)
+)
+
+// words builds a text of distinct words numbered from first to last.
+func words(first, last int) string {
+	var b strings.Builder
+	for i := first; i < last; i++ {
+		fmt.Fprintf(&b, "word%d ", i)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func TestCheck(t *testing.T) {
+	x := New(6)
+
+	if _, ok := x.Check(page("http://a.test/", article)); ok {
+		t.Fatal("first page is a duplicate")
+	}
+	if match, ok := x.Check(page("http://b.test/", article)); !ok || !match.Exact || match.Url != "http://a.test/" {
+		t.Errorf("Check of a copy = %+v, %v, want an exact match of http://a.test/", match, ok)
+	}
+	if match, ok := x.Check(page("http://c.test/", edited)); !ok || match.Exact || match.Url != "http://a.test/" {
+		t.Errorf("Check of an edited copy = %+v, %v, want a near match of http://a.test/", match, ok)
+	}
+	if _, ok := x.Check(page("http://d.test/", other)); ok {
+		t.Error("Check of another page found a duplicate")
+	}
+	if _, ok := x.Check(&models.WebPage{Url: "http://e.test/"}); ok {
+		t.Error("Check of a page without text found a duplicate")
+	}
+}
+
+func TestCheckReplacesRecrawledPage(t *testing.T) {
+	x := New(6)
+
+	x.Check(page("http://a.test/", article))
+	// A RECRAWL IS NOT A DUPLICATE OF ITSELF
+	if match, ok := x.Check(page("http://a.test/", article)); ok {
+		t.Fatalf("recrawl of the same text duplicates %+v", match)
+	}
+	if _, ok := x.Check(page("http://a.test/", other)); ok {
+		t.Fatal("recrawl of a changed page is a duplicate")
+	}
+
+	// THE PAGE NO LONGER HOLDS ITS OLD TEXT
+	if match, ok := x.Check(page("http://b.test/", article)); ok {
+		t.Errorf("Check of the old text matches %+v, want the recrawl to have replaced it", match)
+	}
+	if match, ok := x.Check(page("http://c.test/", other)); !ok || match.Url != "http://a.test/" {
+		t.Errorf("Check of the new text = %+v, %v, want a match of http://a.test/", match, ok)
+	}
+
+	for i, band := range x.bands {
+		for key, entries := range band {
+			seen := make(map[string]bool)
+			for _, e := range entries {
+				if seen[e.url] {
+					t.Errorf("band %d key %x holds `%s` twice", i, key, e.url)
+				}
+				seen[e.url] = true
+			}
+		}
+	}
+}
+
+func TestAddSeedsIndex(t *testing.T) {
+	x := New(6)
+	stored := page("http://a.test/", article)
+	stored.Text = ""
+	x.Add(stored)
+
+	if match, ok := x.Check(page("http://b.test/", article)); !ok || match.Url != "http://a.test/" {
+		t.Errorf("Check of a stored page copy = %+v, %v, want a match of http://a.test/", match, ok)
+	}
+	if _, ok := x.Check(page("http://a.test/", article)); ok {
+		t.Error("recrawl of a stored page duplicates itself")
+	}
+}
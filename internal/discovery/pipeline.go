@@ -0,0 +1,276 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"web-spider/internal/filter"
+	"web-spider/internal/frontier"
+	"web-spider/internal/metrics"
+	"web-spider/internal/models"
+	"web-spider/internal/robots"
+	"web-spider/internal/scope"
+	"web-spider/pkg/logger"
+)
+
+type State int
+
+const (
+	Unseen State = iota
+	Enqueued
+	Crawled
+)
+
+var (
+	ErrDuplicate    = errors.New("url already discovered")
+	ErrDisallowed   = errors.New("url disallowed by robots.txt")
+	ErrLimitReached = errors.New("enqueue limit reached")
+	ErrOutOfScope   = errors.New("url out of crawl scope")
+)
+
+// Pipeline is the only place urls enter the frontier. A url moves from
+// Unseen to Enqueued when it wins the seen set's AddIfAbsent, and from
+// Enqueued to Crawled when its crawl completes, so no url is ever enqueued
+// twice no matter how many workers discover it at once.
+type Pipeline struct {
+	Seen         filter.SeenSet
+	Frontier     frontier.URLFrontier
+	Robots       *robots.Checker
+	Stats        *metrics.CrawlerStats
+	EnqueueLimit int
+	// Scope is optional, a nil Scope lets every url through.
+	Scope    *scope.Scope
+	enqueued int
+	inFlight map[string]bool
+	mu       sync.Mutex
+}
+
+func NewPipeline(seen filter.SeenSet, urlFrontier frontier.URLFrontier, robotsChecker *robots.Checker, stats *metrics.CrawlerStats, enqueueLimit int) *Pipeline {
+	return &Pipeline{
+		Seen:         seen,
+		Frontier:     urlFrontier,
+		Robots:       robotsChecker,
+		Stats:        stats,
+		EnqueueLimit: enqueueLimit,
+		enqueued:     seen.Size(),
+		inFlight:     make(map[string]bool),
+	}
+}
+
+// Discover normalizes a link found at the given depth and enqueues it unless
+// it was already discovered, is out of scope, is disallowed, or the enqueue
+// limit is reached. Out of scope errors wrap both ErrOutOfScope and the scope
+// rejection reason.
+func (p *Pipeline) Discover(ctx context.Context, link string, depth int) error {
+	url, err := filter.NormalizeUrl(link)
+	if err != nil {
+		return err
+	}
+	p.Frontier.ObserveLink(url)
+
+	if p.Scope != nil {
+		if err = p.Scope.Check(url, depth); err != nil {
+			return p.outOfScope(url, err)
+		}
+	}
+
+	if p.Seen.Contains(url) {
+		logger.Info(fmt.Sprintf("Skipping: `%s` is already discovered.", url))
+		p.count(&p.Stats.SkippedDuplicates)
+		return ErrDuplicate
+	}
+
+	if !p.Robots.Allowed(ctx, url) {
+		logger.Info(fmt.Sprintf("Skipping: `%s` is disallowed by robots.txt.", url))
+		p.count(&p.Stats.SkippedDisallowed)
+		return ErrDisallowed
+	}
+	if crawlDelay := p.Robots.CrawlDelay(ctx, url); crawlDelay > 0 {
+		p.Frontier.SetCrawlDelay(url, crawlDelay)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.enqueued >= p.EnqueueLimit {
+		return ErrLimitReached
+	}
+	// ANOTHER WORKER MAY HAVE WON THE RACE SINCE THE Contains CHECK ABOVE
+	if !p.Seen.AddIfAbsent(url) {
+		p.count(&p.Stats.SkippedDuplicates)
+		return ErrDuplicate
+	}
+	// THE HOST BUDGET MAY HAVE BEEN SPENT SINCE THE Check ABOVE, THE url STAYS
+	// SEEN SINCE ITS HOST WILL NEVER HAVE ROOM FOR IT AGAIN
+	if p.Scope != nil {
+		if err = p.Scope.Admit(url); err != nil {
+			return p.outOfScope(url, err)
+		}
+	}
+
+	p.Frontier.Push(frontier.Item{Url: url, Depth: depth})
+	p.inFlight[url] = true
+	p.enqueued++
+
+	p.Stats.MU.Lock()
+	p.Stats.TotalSeen++
+	p.Stats.UniqueEnqueued++
+	p.Stats.MU.Unlock()
+
+	return nil
+}
+
+// Revisit enqueues a stored page due for a recrawl. Unlike Discover it ignores
+// the seen set, which holds every url crawled before, but it still applies the
+// scope, robots.txt and enqueue limit, and skips urls already in flight.
+func (p *Pipeline) Revisit(ctx context.Context, url string, depth int) error {
+	if p.Scope != nil {
+		if err := p.Scope.Check(url, depth); err != nil {
+			return p.outOfScope(url, err)
+		}
+	}
+
+	if !p.Robots.Allowed(ctx, url) {
+		logger.Info(fmt.Sprintf("Skipping: `%s` is disallowed by robots.txt.", url))
+		p.count(&p.Stats.SkippedDisallowed)
+		return ErrDisallowed
+	}
+	if crawlDelay := p.Robots.CrawlDelay(ctx, url); crawlDelay > 0 {
+		p.Frontier.SetCrawlDelay(url, crawlDelay)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inFlight[url] {
+		return ErrDuplicate
+	}
+	if p.enqueued >= p.EnqueueLimit {
+		return ErrLimitReached
+	}
+	if p.Scope != nil {
+		if err := p.Scope.Admit(url); err != nil {
+			return p.outOfScope(url, err)
+		}
+	}
+
+	p.Seen.Add(url)
+	p.Frontier.Revisit(frontier.Item{Url: url, Depth: depth})
+	p.inFlight[url] = true
+	p.enqueued++
+
+	p.Stats.MU.Lock()
+	p.Stats.TotalSeen++
+	p.Stats.RevisitedPages++
+	p.Stats.MU.Unlock()
+
+	return nil
+}
+
+// CheckRedirect tells whether a redirect from a dequeued url, found at the
+// given depth, to link may be followed, applying the scope and robots.txt
+// checks of Discover. A target on the host of the dequeued url takes over its
+// page budget slot, so only one on another host is held to its host's budget.
+// The target is not marked as seen, Redirected does it once the chain ends.
+func (p *Pipeline) CheckRedirect(ctx context.Context, from, link string, depth int) error {
+	url, err := filter.NormalizeUrl(link)
+	if err != nil {
+		return err
+	}
+
+	if p.Scope != nil {
+		check := p.Scope.Check
+		if scope.SameHost(from, url) {
+			check = p.Scope.CheckRules
+		}
+		if err = check(url, depth); err != nil {
+			return p.outOfScope(url, err)
+		}
+	}
+	if !p.Robots.Allowed(ctx, url) {
+		logger.Info(fmt.Sprintf("Skipping: redirect to `%s` is disallowed by robots.txt.", url))
+		p.count(&p.Stats.SkippedDisallowed)
+		return ErrDisallowed
+	}
+	return nil
+}
+
+// Complete marks a dequeued url as crawled, whatever the crawl outcome was.
+func (p *Pipeline) Complete(url string) {
+	p.mu.Lock()
+	delete(p.inFlight, url)
+	p.mu.Unlock()
+
+	p.Frontier.Complete(url)
+}
+
+// Retry puts a dequeued url back in the frontier, it stays Enqueued until a
+// later attempt completes.
+func (p *Pipeline) Retry(item frontier.Item) {
+	p.Frontier.Retry(item)
+}
+
+// Redirected marks every hop of a dequeued url's redirect chain as seen, so
+// none of them is crawled again. It reports false when the final url was
+// already discovered on its own, the redirected page is then a duplicate.
+func (p *Pipeline) Redirected(redirects []models.Redirect, finalUrl string) bool {
+	for _, r := range redirects {
+		if hop, err := filter.NormalizeUrl(r.Url); err == nil {
+			p.Seen.Add(hop)
+		}
+	}
+
+	if !p.Seen.AddIfAbsent(finalUrl) {
+		p.count(&p.Stats.SkippedDuplicates)
+		return false
+	}
+	return true
+}
+
+// State tells where a url stands in the pipeline. Crawled only means seen and
+// not in flight: besides crawled urls, it covers the hops of a redirect chain
+// and the urls that won the seen set but were then rejected by Scope.Admit.
+// Telling them apart would take keeping every url, which the bloom filter
+// seen set is there to avoid.
+func (p *Pipeline) State(url string) State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inFlight[url] {
+		return Enqueued
+	}
+	if p.Seen.Contains(url) {
+		return Crawled
+	}
+	return Unseen
+}
+
+func (p *Pipeline) outOfScope(url string, reason error) error {
+	logger.Info(fmt.Sprintf("Skipping: `%s` is out of the crawl scope: %v.", url, reason))
+
+	switch {
+	case errors.Is(reason, scope.ErrDomainNotAllowed):
+		p.count(&p.Stats.SkippedDomainNotAllowed)
+	case errors.Is(reason, scope.ErrDomainBlocked):
+		p.count(&p.Stats.SkippedDomainBlocked)
+	case errors.Is(reason, scope.ErrNotIncluded):
+		p.count(&p.Stats.SkippedNotIncluded)
+	case errors.Is(reason, scope.ErrExcluded):
+		p.count(&p.Stats.SkippedExcluded)
+	case errors.Is(reason, scope.ErrTooDeep):
+		p.count(&p.Stats.SkippedTooDeep)
+	case errors.Is(reason, scope.ErrHostLimit):
+		p.count(&p.Stats.SkippedHostLimit)
+	case errors.Is(reason, scope.ErrBlockedExtension):
+		p.count(&p.Stats.SkippedBlockedExtension)
+	}
+
+	return fmt.Errorf("%w: %w", ErrOutOfScope, reason)
+}
+
+func (p *Pipeline) count(counter *int) {
+	p.Stats.MU.Lock()
+	defer p.Stats.MU.Unlock()
+	*counter++
+}
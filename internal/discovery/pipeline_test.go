@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"web-spider/internal/filter"
+	"web-spider/internal/frontier"
+	"web-spider/internal/metrics"
+	"web-spider/internal/robots"
+	"web-spider/internal/scope"
+)
+
+func newTestPipeline(t *testing.T, seen filter.SeenSet) (*Pipeline, string) {
+	t.Helper()
+
+	// A 404 robots.txt ALLOWS EVERYTHING
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	checker := robots.NewChecker("test-agent", time.Hour)
+	p := NewPipeline(seen, frontier.NewFrontier(0, nil), checker, metrics.NewCrawlerStats(), 1_000_000)
+	return p, server.URL
+}
+
+func TestDiscoverEnqueuesEachUrlOnce(t *testing.T) {
+	const (
+		workers = 16
+		unique  = 500
+	)
+	sets := []struct {
+		name   string
+		newSet func() (filter.SeenSet, error)
+		// A BLOOM FILTER MAY TAKE A NEW URL FOR A SEEN ONE, SO IT CAN ONLY
+		// BE HELD TO A BOUND
+		maxMissed int
+	}{
+		{"UrlSet", func() (filter.SeenSet, error) { return &filter.UrlSet{Set: make(map[uint64]bool)}, nil }, 0},
+		{"ScalableBloomFilter", func() (filter.SeenSet, error) { return filter.NewScalableBloomFilter(100, 0.0001) }, unique / 100},
+	}
+
+	for _, set := range sets {
+		t.Run(set.name, func(t *testing.T) {
+			seen, err := set.newSet()
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, base := newTestPipeline(t, seen)
+
+			// EVERY SUCCESSFUL Discover SIGNALS THE CONSUMER, WHICH COMPLETES
+			// URLS WHILE OTHERS ARE STILL BEING DISCOVERED
+			enqueued := make(chan struct{}, workers*unique)
+			popped := make(map[string]bool)
+			consumed := make(chan struct{})
+			go func() {
+				defer close(consumed)
+				for range enqueued {
+					item, ok := p.Frontier.TryPop()
+					if !ok {
+						t.Error("TryPop found nothing after a successful Discover")
+						continue
+					}
+					if popped[item.Url] {
+						t.Errorf("`%s` was dequeued twice", item.Url)
+					}
+					popped[item.Url] = true
+					p.Complete(item.Url)
+				}
+			}()
+
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					// EVERY WORKER DISCOVERS EVERY URL, STARTING AT A DIFFERENT OFFSET
+					for i := 0; i < unique; i++ {
+						link := fmt.Sprintf("%s/page/%d", base, (i+w*unique/workers)%unique)
+						switch err := p.Discover(context.Background(), link, 1); err {
+						case nil:
+							enqueued <- struct{}{}
+						case ErrDuplicate:
+						default:
+							t.Errorf("Discover(%s): %v", link, err)
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(enqueued)
+			<-consumed
+
+			if p.Frontier.Size() != 0 {
+				t.Errorf("Size = %d after draining the frontier, want 0", p.Frontier.Size())
+			}
+			got := p.Stats.UniqueEnqueued
+			if got != len(popped) {
+				t.Errorf("UniqueEnqueued = %d, but %d urls were dequeued", got, len(popped))
+			}
+			if got > unique || got < unique-set.maxMissed {
+				t.Errorf("UniqueEnqueued = %d, want between %d and %d", got, unique-set.maxMissed, unique)
+			}
+			if want := workers*unique - got; p.Stats.SkippedDuplicates != want {
+				t.Errorf("SkippedDuplicates = %d, want %d", p.Stats.SkippedDuplicates, want)
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	p, base := newTestPipeline(t, &filter.UrlSet{Set: make(map[uint64]bool)})
+	url := base + "/a"
+
+	if got := p.State(url); got != Unseen {
+		t.Errorf("State before Discover = %v, want Unseen", got)
+	}
+	if err := p.Discover(context.Background(), url, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.State(url); got != Enqueued {
+		t.Errorf("State after Discover = %v, want Enqueued", got)
+	}
+	p.Complete(url)
+	if got := p.State(url); got != Crawled {
+		t.Errorf("State after Complete = %v, want Crawled", got)
+	}
+}
+
+func TestCheckRedirectHostBudget(t *testing.T) {
+	p, base := newTestPipeline(t, &filter.UrlSet{Set: make(map[uint64]bool)})
+	s, err := scope.New(scope.Rules{MaxPagesPerHost: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Scope = s
+
+	// THE ONLY PAGE OF THE HOST TAKES ITS WHOLE BUDGET
+	from := base + "/a"
+	if err := p.Discover(context.Background(), from, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Discover(context.Background(), base+"/b", 0); !errors.Is(err, scope.ErrHostLimit) {
+		t.Fatalf("Discover past the host budget = %v, want ErrHostLimit", err)
+	}
+
+	if err := p.CheckRedirect(context.Background(), from, from+"/", 0); err != nil {
+		t.Errorf("CheckRedirect to the same host = %v, want nil", err)
+	}
+
+	other := "http://other.invalid/"
+	if err := s.Admit(other + "a"); err != nil {
+		t.Fatal(err)
+	}
+	err = p.CheckRedirect(context.Background(), from, other+"b", 0)
+	if !errors.Is(err, ErrOutOfScope) || !errors.Is(err, scope.ErrHostLimit) {
+		t.Errorf("CheckRedirect to a spent host = %v, want ErrHostLimit", err)
+	}
+}
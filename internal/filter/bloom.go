@@ -0,0 +1,307 @@
+package filter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+const (
+	bloomMagic = "SBF2"
+	// Each new slice is twice as large and twice as strict as the previous
+	// one, which bounds the compound false-positive rate by FPRate.
+	bloomGrowth    = 2
+	bloomTightness = 0.5
+)
+
+type bloomSlice struct {
+	bits     []uint64
+	m        uint64
+	k        int
+	capacity int
+	count    int
+}
+
+// ScalableBloomFilter is a seen set whose memory use grows with the number of
+// urls at a fixed false-positive rate, at the price of never giving a false
+// negative but occasionally a false positive.
+type ScalableBloomFilter struct {
+	FPRate          float64
+	InitialCapacity int
+	Length          int
+	slices          []*bloomSlice
+	mu              sync.Mutex
+}
+
+func NewScalableBloomFilter(initialCapacity int, fpRate float64) (*ScalableBloomFilter, error) {
+	if initialCapacity <= 0 {
+		return nil, fmt.Errorf("bloom filter capacity must be positive, got %d", initialCapacity)
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("bloom filter false-positive rate must be in (0, 1), got %f", fpRate)
+	}
+
+	return &ScalableBloomFilter{FPRate: fpRate, InitialCapacity: initialCapacity}, nil
+}
+
+func (b *ScalableBloomFilter) Add(url string) {
+	b.AddIfAbsent(url)
+}
+
+// AddIfAbsent reports false for urls that were added before, and for the
+// occasional false positive.
+func (b *ScalableBloomFilter) AddIfAbsent(url string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.add(url)
+}
+
+func (b *ScalableBloomFilter) Contains(url string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.contains(url)
+}
+
+func (b *ScalableBloomFilter) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Length
+}
+
+func (b *ScalableBloomFilter) EstimatedFalsePositiveRate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A LOOKUP IS A FALSE POSITIVE IF ANY SLICE REPORTS ONE
+	pass := 1.0
+	for _, s := range b.slices {
+		fill := 1 - math.Exp(-float64(s.k)*float64(s.count)/float64(s.m))
+		pass *= 1 - math.Pow(fill, float64(s.k))
+	}
+
+	return 1 - pass
+}
+
+func (b *ScalableBloomFilter) MemoryBytes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	for _, s := range b.slices {
+		total += len(s.bits) * 8
+	}
+	return total
+}
+
+func (b *ScalableBloomFilter) Save(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	w.WriteString(bloomMagic)
+	header := []any{b.FPRate, int64(b.InitialCapacity), int64(b.Length), int64(len(b.slices))}
+	for _, v := range header {
+		binary.Write(w, binary.LittleEndian, v)
+	}
+	for _, s := range b.slices {
+		meta := []any{s.m, int64(s.k), int64(s.capacity), int64(s.count)}
+		for _, v := range meta {
+			binary.Write(w, binary.LittleEndian, v)
+		}
+		binary.Write(w, binary.LittleEndian, s.bits)
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Load restores a checkpoint written by Save. A missing file is not an error.
+func (b *ScalableBloomFilter) Load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic := make([]byte, len(bloomMagic))
+	if _, err = io.ReadFull(r, magic); err != nil {
+		return err
+	}
+	if string(magic) != bloomMagic {
+		return fmt.Errorf("%s is not a bloom filter checkpoint", path)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var fpRate float64
+	var initialCapacity, length, nSlices int64
+	for _, v := range []any{&fpRate, &initialCapacity, &length, &nSlices} {
+		if err = binary.Read(r, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if nSlices < 0 || length < 0 {
+		return fmt.Errorf("%s is a corrupt bloom filter checkpoint", path)
+	}
+
+	// EVERY SIZE READ IS CHECKED AGAINST WHAT IS LEFT OF THE FILE BEFORE
+	// ANYTHING IS ALLOCATED FROM IT
+	left := uint64(info.Size()) - uint64(len(bloomMagic)) - 4*8
+	var slices []*bloomSlice
+	for i := int64(0); i < nSlices; i++ {
+		var m uint64
+		var k, capacity, count int64
+		for _, v := range []any{&m, &k, &capacity, &count} {
+			if err = binary.Read(r, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		if left < 4*8 {
+			return fmt.Errorf("%s is a truncated bloom filter checkpoint", path)
+		}
+		left -= 4 * 8
+		if m == 0 || k <= 0 || capacity <= 0 || count < 0 {
+			return fmt.Errorf("%s is a corrupt bloom filter checkpoint: slice %d has m=%d, k=%d", path, i, m, k)
+		}
+		words := (m + 63) / 64
+		if words > left/8 {
+			return fmt.Errorf("%s is a truncated bloom filter checkpoint: slice %d needs %d bits", path, i, m)
+		}
+		left -= words * 8
+
+		bits := make([]uint64, words)
+		if err = binary.Read(r, binary.LittleEndian, bits); err != nil {
+			return err
+		}
+		slices = append(slices, &bloomSlice{bits: bits, m: m, k: int(k), capacity: int(capacity), count: int(count)})
+	}
+	if left != 0 {
+		return fmt.Errorf("%s is a corrupt bloom filter checkpoint: %d trailing bytes", path, left)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.FPRate = fpRate
+	b.InitialCapacity = int(initialCapacity)
+	b.Length = int(length)
+	b.slices = slices
+
+	return nil
+}
+
+func (b *ScalableBloomFilter) add(url string) bool {
+	if b.contains(url) {
+		return false
+	}
+
+	last := len(b.slices) - 1
+	if last < 0 || b.slices[last].count >= b.slices[last].capacity {
+		b.grow()
+		last++
+	}
+
+	h1, h2 := bloomHashes(url)
+	b.slices[last].add(h1, h2)
+	b.Length++
+
+	return true
+}
+
+func (b *ScalableBloomFilter) contains(url string) bool {
+	h1, h2 := bloomHashes(url)
+	for _, s := range b.slices {
+		if s.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *ScalableBloomFilter) grow() {
+	i := len(b.slices)
+	capacity := b.InitialCapacity * int(math.Pow(bloomGrowth, float64(i)))
+	p := b.FPRate * (1 - bloomTightness) * math.Pow(bloomTightness, float64(i))
+
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := max(int(math.Ceil(-math.Log2(p))), 1)
+
+	b.slices = append(b.slices, &bloomSlice{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+	})
+}
+
+func (s *bloomSlice) add(h1, h2 uint64) {
+	for i := 0; i < s.k; i++ {
+		idx := (h1 + uint64(i)*h2) % s.m
+		s.bits[idx/64] |= 1 << (idx % 64)
+	}
+	s.count++
+}
+
+func (s *bloomSlice) contains(h1, h2 uint64) bool {
+	for i := 0; i < s.k; i++ {
+		idx := (h1 + uint64(i)*h2) % s.m
+		if s.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomSeed starts the second hash in a different state than the first one.
+const bloomSeed = "\x9e\x37\x79\xb9\x7f\x4a\x7c\x15"
+
+// bloomHashes derives the two base hashes of the Kirsch-Mitzenmacher double
+// hashing scheme, h1 + i*h2. They are FNV-1a hashes of the url with and
+// without a seed, each run through a finalizer so that they are not
+// correlated. h2 is odd so that it is never 0, the k probes then only
+// collapse onto one bit in the rare case h2 is a multiple of the slice size.
+func bloomHashes(url string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(bloomSeed))
+	h.Write([]byte(url))
+
+	return mix64(HashUrl(url)), mix64(h.Sum64()) | 1
+}
+
+// mix64 is the 64-bit finalizer of MurmurHash3.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
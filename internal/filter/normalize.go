@@ -0,0 +1,329 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	url2 "net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+var trackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid", "mc_cid", "mc_eid", "_ga", "_gl",
+}
+
+type DomainRules struct {
+	Domain      string   `json:"domain"`
+	AllowParams []string `json:"allowParams"`
+	DenyParams  []string `json:"denyParams"`
+}
+
+// NormalizationRules drive NormalizeUrl. Param lists accept a trailing `*`
+// as a prefix wildcard, e.g. `utm_*`. An empty allow list keeps every param
+// that is not denied. Domain rules apply to the domain and its subdomains
+// and replace the global param lists.
+type NormalizationRules struct {
+	AllowParams              []string      `json:"allowParams"`
+	DenyParams               []string      `json:"denyParams"`
+	StripTrackingParams      bool          `json:"stripTrackingParams"`
+	SortQuery                bool          `json:"sortQuery"`
+	RemoveDefaultPorts       bool          `json:"removeDefaultPorts"`
+	ResolveDotSegments       bool          `json:"resolveDotSegments"`
+	NormalizePercentEncoding bool          `json:"normalizePercentEncoding"`
+	FoldWww                  bool          `json:"foldWww"`
+	TrailingSlash            string        `json:"trailingSlash"`
+	Domains                  []DomainRules `json:"domains"`
+}
+
+type Normalizer struct {
+	Rules NormalizationRules
+}
+
+var defaultNormalizer = NewNormalizer(DefaultNormalizationRules())
+
+// DefaultNormalizationRules keep the historical `page`, `lang` and `id`
+// query param keep-list.
+func DefaultNormalizationRules() NormalizationRules {
+	return NormalizationRules{
+		AllowParams:              []string{"page", "lang", "id"},
+		StripTrackingParams:      true,
+		SortQuery:                true,
+		RemoveDefaultPorts:       true,
+		ResolveDotSegments:       true,
+		NormalizePercentEncoding: true,
+		TrailingSlash:            "keep",
+	}
+}
+
+// LoadNormalizationRules reads JSON rules from path. Fields missing from the
+// file keep their default value.
+func LoadNormalizationRules(path string) (NormalizationRules, error) {
+	rules := DefaultNormalizationRules()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err = json.Unmarshal(content, &rules); err != nil {
+		return rules, fmt.Errorf("invalid normalization rules in %s: %w", path, err)
+	}
+
+	switch rules.TrailingSlash {
+	case "", "keep", "add", "remove":
+	default:
+		return rules, fmt.Errorf("invalid trailingSlash policy `%s` in %s", rules.TrailingSlash, path)
+	}
+
+	return rules, nil
+}
+
+func NewNormalizer(rules NormalizationRules) *Normalizer {
+	return &Normalizer{Rules: rules}
+}
+
+// SetNormalizer replaces the rules used by NormalizeUrl. It is meant to be
+// called once at startup, before any crawling goroutine runs.
+func SetNormalizer(n *Normalizer) {
+	defaultNormalizer = n
+}
+
+func NormalizeUrl(url string) (string, error) {
+	return defaultNormalizer.Normalize(url)
+}
+
+func (n *Normalizer) Normalize(url string) (string, error) {
+	u, err := url2.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	rules := n.Rules
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	// HOST
+	hostname := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if rules.RemoveDefaultPorts && ((u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443")) {
+		port = ""
+	}
+	if rules.FoldWww {
+		hostname = strings.TrimPrefix(hostname, "www.")
+	}
+	// IPv6 LITERALS NEED THEIR BRACKETS BACK
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(hostname, port)
+	case strings.Contains(hostname, ":"):
+		u.Host = "[" + hostname + "]"
+	default:
+		u.Host = hostname
+	}
+
+	// PATH
+	path := u.EscapedPath()
+	if rules.NormalizePercentEncoding {
+		path = normalizePercentEncoding(path)
+	}
+	if rules.ResolveDotSegments {
+		path = removeDotSegments(path)
+	}
+	if path == "" {
+		path = "/"
+	}
+	switch rules.TrailingSlash {
+	case "add":
+		last := path[strings.LastIndex(path, "/")+1:]
+		if last != "" && !strings.Contains(last, ".") {
+			path += "/"
+		}
+	case "remove":
+		if len(path) > 1 {
+			path = strings.TrimRight(path, "/")
+			if path == "" {
+				path = "/"
+			}
+		}
+	}
+	u.Path, err = url2.PathUnescape(path)
+	if err != nil {
+		return "", err
+	}
+	u.RawPath = path
+
+	// QUERY
+	u.RawQuery = n.normalizeQuery(u.RawQuery, hostname)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func (n *Normalizer) normalizeQuery(rawQuery, hostname string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	allow, deny := n.Rules.AllowParams, n.Rules.DenyParams
+	if domain := n.domainRules(hostname); domain != nil {
+		allow, deny = domain.AllowParams, domain.DenyParams
+	}
+
+	var pairs []string
+	var keys []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, _, _ := strings.Cut(pair, "=")
+		key, err := url2.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+
+		if n.Rules.StripTrackingParams && matchParam(trackingParams, key) {
+			continue
+		}
+		if matchParam(deny, key) {
+			continue
+		}
+		if len(allow) > 0 && !matchParam(allow, key) {
+			continue
+		}
+
+		if n.Rules.NormalizePercentEncoding {
+			pair = normalizePercentEncoding(pair)
+		}
+		pairs = append(pairs, pair)
+		keys = append(keys, key)
+	}
+
+	if n.Rules.SortQuery {
+		idx := make([]int, len(pairs))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(a, b int) bool {
+			return keys[idx[a]] < keys[idx[b]]
+		})
+		sorted := make([]string, len(pairs))
+		for i, j := range idx {
+			sorted[i] = pairs[j]
+		}
+		pairs = sorted
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func (n *Normalizer) domainRules(hostname string) *DomainRules {
+	var best *DomainRules
+	for i := range n.Rules.Domains {
+		d := &n.Rules.Domains[i]
+		domain := strings.ToLower(d.Domain)
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			if best == nil || len(domain) > len(best.Domain) {
+				best = d
+			}
+		}
+	}
+	return best
+}
+
+func matchParam(patterns []string, key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePercentEncoding uppercases escape hex digits and decodes escaped
+// unreserved characters (RFC 3986, section 6.2.2.2).
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// removeDotSegments implements RFC 3986, section 5.2.4.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	var out []string
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+func isUnreserved(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
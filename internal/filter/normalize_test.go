@@ -0,0 +1,121 @@
+package filter
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	defaults := DefaultNormalizationRules()
+
+	withRules := func(edit func(r *NormalizationRules)) NormalizationRules {
+		r := DefaultNormalizationRules()
+		edit(&r)
+		return r
+	}
+	addSlash := withRules(func(r *NormalizationRules) { r.TrailingSlash = "add" })
+	removeSlash := withRules(func(r *NormalizationRules) { r.TrailingSlash = "remove" })
+	foldWww := withRules(func(r *NormalizationRules) { r.FoldWww = true })
+	anyParam := withRules(func(r *NormalizationRules) {
+		r.AllowParams = nil
+		r.DenyParams = []string{"sessionid", "ref_*"}
+	})
+	domains := withRules(func(r *NormalizationRules) {
+		r.Domains = []DomainRules{
+			{Domain: "example.com", AllowParams: []string{"q"}},
+			{Domain: "docs.example.com", AllowParams: []string{"v"}, DenyParams: []string{"page"}},
+		}
+	})
+
+	tests := []struct {
+		name  string
+		rules NormalizationRules
+		in    string
+		want  string
+	}{
+		{"lowercase scheme and host", defaults, "HTTP://Example.COM/Path", "http://example.com/Path"},
+		{"fragment dropped", defaults, "http://example.com/a#top", "http://example.com/a"},
+		{"empty path", defaults, "http://example.com", "http://example.com/"},
+
+		{"default http port", defaults, "http://example.com:80/a", "http://example.com/a"},
+		{"default https port", defaults, "https://example.com:443/a", "https://example.com/a"},
+		{"non default port kept", defaults, "http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https port on http kept", defaults, "http://example.com:443/a", "http://example.com:443/a"},
+		{"default ports kept when disabled", withRules(func(r *NormalizationRules) { r.RemoveDefaultPorts = false }),
+			"http://example.com:80/a", "http://example.com:80/a"},
+
+		{"single dot", defaults, "http://example.com/a/./b", "http://example.com/a/b"},
+		{"double dot", defaults, "http://example.com/a/b/../c", "http://example.com/a/c"},
+		{"double dot past root", defaults, "http://example.com/../a", "http://example.com/a"},
+		{"trailing double dot", defaults, "http://example.com/a/b/..", "http://example.com/a/"},
+		{"dots kept when disabled", withRules(func(r *NormalizationRules) { r.ResolveDotSegments = false }),
+			"http://example.com/a/./b", "http://example.com/a/./b"},
+
+		{"escape hex uppercased", defaults, "http://example.com/a%2fb", "http://example.com/a%2Fb"},
+		{"unreserved escape decoded", defaults, "http://example.com/%7Euser/%41", "http://example.com/~user/A"},
+		{"reserved escape kept", defaults, "http://example.com/a%20b", "http://example.com/a%20b"},
+		{"query escape normalized", defaults, "http://example.com/?id=%7e%2f", "http://example.com/?id=~%2F"},
+
+		{"keep slash policy", defaults, "http://example.com/a/", "http://example.com/a/"},
+		{"keep no slash policy", defaults, "http://example.com/a", "http://example.com/a"},
+		{"add slash", addSlash, "http://example.com/a", "http://example.com/a/"},
+		{"add slash skips files", addSlash, "http://example.com/a.html", "http://example.com/a.html"},
+		{"add slash on root", addSlash, "http://example.com/", "http://example.com/"},
+		{"remove slash", removeSlash, "http://example.com/a//", "http://example.com/a"},
+		{"remove slash keeps root", removeSlash, "http://example.com/", "http://example.com/"},
+
+		{"www kept by default", defaults, "http://www.example.com/", "http://www.example.com/"},
+		{"www folded", foldWww, "http://WWW.example.com/", "http://example.com/"},
+		{"www only folded as a label", foldWww, "http://wwwexample.com/", "http://wwwexample.com/"},
+
+		{"query sorted", defaults, "http://example.com/?page=2&id=1&lang=en", "http://example.com/?id=1&lang=en&page=2"},
+		{"query sort is stable", defaults, "http://example.com/?id=2&id=1", "http://example.com/?id=2&id=1"},
+		{"params outside the allow list dropped", defaults, "http://example.com/?id=1&q=x", "http://example.com/?id=1"},
+		{"tracking params stripped", anyParam, "http://example.com/?utm_source=x&fbclid=y&q=1&gclid=z", "http://example.com/?q=1"},
+		{"denied params dropped", anyParam, "http://example.com/?sessionid=1&ref_src=2&b=3&a=4", "http://example.com/?a=4&b=3"},
+		{"empty query dropped", defaults, "http://example.com/a?", "http://example.com/a"},
+		{"query kept unsorted when disabled", withRules(func(r *NormalizationRules) {
+			r.AllowParams = nil
+			r.SortQuery = false
+		}), "http://example.com/?b=1&a=2", "http://example.com/?b=1&a=2"},
+
+		{"domain rules replace global lists", domains, "http://example.com/?q=go&id=1", "http://example.com/?q=go"},
+		{"domain rules apply to subdomains", domains, "http://www.example.com/?q=go&id=1", "http://www.example.com/?q=go"},
+		{"most specific domain wins", domains, "http://docs.example.com/?v=2&q=go&page=1", "http://docs.example.com/?v=2"},
+		{"other domains keep global lists", domains, "http://example.org/?q=go&id=1", "http://example.org/?id=1"},
+		{"domain suffix is not a subdomain", domains, "http://notexample.com/?q=go&id=1", "http://notexample.com/?id=1"},
+
+		{"ipv6 with port", defaults, "http://[::1]:8080/a", "http://[::1]:8080/a"},
+		{"ipv6 without port", defaults, "http://[2001:DB8::1]/a", "http://[2001:db8::1]/a"},
+		{"ipv6 default port", defaults, "http://[::1]:80/a", "http://[::1]/a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewNormalizer(tt.rules).Normalize(tt.in)
+			if err != nil {
+				t.Fatalf("Normalize(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeIsIdempotent(t *testing.T) {
+	n := NewNormalizer(DefaultNormalizationRules())
+	for _, in := range []string{
+		"http://[::1]:8080/a/../b?page=1&id=2",
+		"HTTPS://Example.com:443/%7efoo/./bar?utm_source=x",
+	} {
+		once, err := n.Normalize(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		twice, err := n.Normalize(once)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if once != twice {
+			t.Errorf("Normalize(%q) = %q, normalized again %q", in, once, twice)
+		}
+	}
+}
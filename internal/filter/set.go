@@ -1,12 +1,33 @@
 package filter
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"hash/fnv"
-	url2 "net/url"
-	"strings"
+	"io"
+	"math"
+	"os"
 	"sync"
 )
 
+// SeenSet keeps track of the urls the crawler has already discovered.
+type SeenSet interface {
+	Add(url string)
+	// AddIfAbsent adds the url and reports whether it was not already in the
+	// set, as a single atomic step.
+	AddIfAbsent(url string) bool
+	Contains(url string) bool
+	Size() int
+	Save(path string) error
+	Load(path string) error
+	EstimatedFalsePositiveRate() float64
+	MemoryBytes() int
+}
+
+// Rough per-entry cost of a map[uint64]bool, including bucket overhead.
+const urlSetEntryBytes = 16
+
 type UrlSet struct {
 	Length int
 	Set    map[uint64]bool
@@ -14,10 +35,21 @@ type UrlSet struct {
 }
 
 func (s *UrlSet) Add(url string) {
+	s.AddIfAbsent(url)
+}
+
+func (s *UrlSet) AddIfAbsent(url string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.Set[HashUrl(url)] = true
+
+	hash := HashUrl(url)
+	if s.Set[hash] {
+		return false
+	}
+	s.Set[hash] = true
 	s.Length++
+
+	return true
 }
 
 func (s *UrlSet) Contains(url string) bool {
@@ -34,41 +66,94 @@ func (s *UrlSet) Size() int {
 	return s.Length
 }
 
-func HashUrl(url string) uint64 {
-	h := fnv.New64a()
-	h.Write([]byte(url))
+// EstimatedFalsePositiveRate is the chance of a 64-bit hash collision with
+// any of the stored urls.
+func (s *UrlSet) EstimatedFalsePositiveRate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return float64(len(s.Set)) / math.Pow(2, 64)
+}
 
-	return h.Sum64()
+func (s *UrlSet) MemoryBytes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.Set) * urlSetEntryBytes
 }
 
-func NormalizeUrl(url string) (string, error) {
-	normalizedUrl, err := url2.Parse(url)
+// Save checkpoints the set to path. The file is written aside and renamed,
+// so a crash mid-checkpoint leaves the previous one intact.
+func (s *UrlSet) Save(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	normalizedUrl.Fragment = ""
+	w := bufio.NewWriter(file)
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(s.Length))
+	w.Write(buf)
+	for hash := range s.Set {
+		binary.LittleEndian.PutUint64(buf, hash)
+		w.Write(buf)
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
 
-	// LITTLE LOGIC TO PREVENT OVER NORMALIZATION OF URLs
-	keep := map[string]bool{
-		"page": true,
-		"lang": true,
-		"id":   true,
+// Load restores a checkpoint written by Save. A missing file is not an error.
+func (s *UrlSet) Load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
 	}
-	q := normalizedUrl.Query()
-	for k, _ := range q {
-		if !keep[k] {
-			q.Del(k)
-		}
+	if err != nil {
+		return err
 	}
-	normalizedUrl.RawQuery = q.Encode()
+	defer file.Close()
 
-	normalizedUrl.Scheme = strings.ToLower(normalizedUrl.Scheme)
-	normalizedUrl.Host = strings.ToLower(normalizedUrl.Host)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if normalizedUrl.Path == "" {
-		normalizedUrl.Path = "/"
+	r := bufio.NewReader(file)
+	buf := make([]byte, 8)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return err
 	}
+	s.Length = int(binary.LittleEndian.Uint64(buf))
+	if s.Set == nil {
+		s.Set = make(map[uint64]bool, s.Length)
+	}
+	for {
+		_, err = io.ReadFull(r, buf)
+		if errors.Is(err, io.EOF) {
+			s.Length = len(s.Set)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.Set[binary.LittleEndian.Uint64(buf)] = true
+	}
+}
 
-	return normalizedUrl.String(), nil
+func HashUrl(url string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+
+	return h.Sum64()
 }
@@ -0,0 +1,73 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of consecutive words hashed together as one
+// SimHash feature, so that word order matters and not only the vocabulary.
+const shingleSize = 3
+
+// TextHash is the hex SHA-256 of the extracted text, equal only for pages
+// with exactly the same text.
+func TextHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// SimHash is the 64-bit SimHash of the text's word shingles. Texts differing
+// by a few words get hashes differing by a few bits, see Distance.
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	size := min(shingleSize, len(words))
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		feature := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if feature&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+
+	var simHash uint64
+	for b, w := range weights {
+		if w > 0 {
+			simHash |= 1 << b
+		}
+	}
+	return simHash
+}
+
+// Distance is the Hamming distance between two SimHashes, the number of bits
+// they differ by.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Format is how a SimHash is stored, as 16 hex digits since BSON has no
+// unsigned 64-bit integers.
+func Format(simHash uint64) string {
+	return fmt.Sprintf("%016x", simHash)
+}
+
+func Parse(simHash string) (uint64, error) {
+	return strconv.ParseUint(simHash, 16, 64)
+}
@@ -0,0 +1,270 @@
+package frontier
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-spider/pkg/logger"
+)
+
+const logFileName = "frontier.log"
+
+// DiskFrontier journals every push and completion of an in-memory Frontier
+// to an append-only log, so the crawl can be resumed after a crash. Records
+// are tab-separated lines:
+//
+//	P <depth> <url>                          url pushed
+//	R <depth> <attempts> <notBefore> <url>   url put back for a retry
+//	V <depth> <url>                          crawled url queued again for a recrawl
+//	C <url>                                  url crawled
+//	T <count>                                processed urls carried over from a compacted log
+//
+// notBefore is a unix time in nanoseconds. Compact rewrites the log down to
+// the urls still pending.
+type DiskFrontier struct {
+	*Frontier
+	Dir  string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// OpenDiskFrontier opens the journal in dir. When resume is set, the journal
+// is replayed into inner, seen is called for every url it contains, and the
+// journal is compacted down to the still pending urls. Otherwise any
+// previous journal is discarded.
+func OpenDiskFrontier(dir string, inner *Frontier, resume bool, seen func(url string)) (*DiskFrontier, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, logFileName)
+	var pending []Item
+	processed := 0
+	if resume {
+		var err error
+		pending, processed, err = replay(path, seen)
+		if err != nil {
+			return nil, err
+		}
+		if err = compact(path, pending, processed); err != nil {
+			return nil, err
+		}
+	} else if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range pending {
+		inner.Push(item)
+	}
+	inner.mu.Lock()
+	inner.TotalProcessed = processed
+	inner.mu.Unlock()
+
+	return &DiskFrontier{Frontier: inner, Dir: dir, file: file}, nil
+}
+
+func (q *DiskFrontier) Enqueue(url string) {
+	q.Push(Item{Url: url})
+}
+
+func (q *DiskFrontier) Push(item Item) {
+	q.write(fmt.Sprintf("P\t%d\t%s\n", item.Depth, item.Url))
+	q.Frontier.Push(item)
+}
+
+func (q *DiskFrontier) Retry(item Item) {
+	q.write(retryRecord(item))
+	q.Frontier.Retry(item)
+}
+
+func (q *DiskFrontier) Revisit(item Item) {
+	q.write(fmt.Sprintf("V\t%d\t%s\n", item.Depth, item.Url))
+	q.Frontier.Revisit(item)
+}
+
+func (q *DiskFrontier) Complete(url string) {
+	q.write(fmt.Sprintf("C\t%s\n", url))
+	q.Frontier.Complete(url)
+}
+
+func (q *DiskFrontier) Sync() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Sync()
+}
+
+// Compact rewrites the journal down to the urls pushed and not crawled yet,
+// in flight ones included, so it doesn't grow with the whole crawl. Records
+// wait for the rewrite to finish.
+func (q *DiskFrontier) Compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.file.Sync(); err != nil {
+		return err
+	}
+	path := filepath.Join(q.Dir, logFileName)
+	pending, processed, err := replay(path, nil)
+	if err != nil {
+		return err
+	}
+	if err = compact(path, pending, processed); err != nil {
+		return err
+	}
+
+	// THE OLD HANDLE STILL POINTS AT THE REPLACED FILE
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	q.file.Close()
+	q.file = file
+
+	return nil
+}
+
+func (q *DiskFrontier) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.file.Sync(); err != nil {
+		return err
+	}
+	return q.file.Close()
+}
+
+func (q *DiskFrontier) write(record string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.file.WriteString(record); err != nil {
+		logger.Error(fmt.Sprintf("Failed to journal frontier record: %v", err))
+	}
+}
+
+func replay(path string, seen func(url string)) ([]Item, int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var order []string
+	items := make(map[string]Item)
+	completed := make(map[string]bool)
+	processed := 0
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch {
+		case fields[0] == "P" && len(fields) == 3:
+			depth, err := strconv.Atoi(fields[1])
+			if err != nil {
+				continue
+			}
+			url := fields[2]
+			if _, ok := items[url]; !ok {
+				order = append(order, url)
+				items[url] = Item{Url: url, Depth: depth}
+				if seen != nil {
+					seen(url)
+				}
+			}
+		case fields[0] == "R" && len(fields) == 5:
+			depth, errDepth := strconv.Atoi(fields[1])
+			attempts, errAttempts := strconv.Atoi(fields[2])
+			notBefore, errNotBefore := strconv.ParseInt(fields[3], 10, 64)
+			url := fields[4]
+			if _, ok := items[url]; !ok || errDepth != nil || errAttempts != nil || errNotBefore != nil {
+				continue
+			}
+			items[url] = Item{Url: url, Depth: depth, Attempts: attempts, NotBefore: time.Unix(0, notBefore)}
+		case fields[0] == "V" && len(fields) == 3:
+			depth, err := strconv.Atoi(fields[1])
+			if err != nil {
+				continue
+			}
+			url := fields[2]
+			if _, ok := items[url]; !ok {
+				order = append(order, url)
+				if seen != nil {
+					seen(url)
+				}
+			}
+			// A REVISITED url IS PENDING AGAIN UNTIL ITS NEXT COMPLETION
+			items[url] = Item{Url: url, Depth: depth}
+			delete(completed, url)
+		case fields[0] == "C" && len(fields) == 2:
+			if !completed[fields[1]] {
+				completed[fields[1]] = true
+				processed++
+			}
+		case fields[0] == "T" && len(fields) == 2:
+			n, err := strconv.Atoi(fields[1])
+			if err == nil {
+				processed += n
+			}
+		}
+		// A TRUNCATED LAST LINE FROM A CRASH IS SIMPLY IGNORED
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	pending := make([]Item, 0, len(order))
+	for _, url := range order {
+		if !completed[url] {
+			pending = append(pending, items[url])
+		}
+	}
+
+	return pending, processed, nil
+}
+
+func compact(path string, pending []Item, processed int) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "T\t%d\n", processed)
+	for _, item := range pending {
+		fmt.Fprintf(w, "P\t%d\t%s\n", item.Depth, item.Url)
+		if item.Attempts > 0 {
+			w.WriteString(retryRecord(item))
+		}
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func retryRecord(item Item) string {
+	return fmt.Sprintf("R\t%d\t%d\t%d\t%s\n", item.Depth, item.Attempts, item.NotBefore.UnixNano(), item.Url)
+}
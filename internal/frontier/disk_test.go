@@ -0,0 +1,121 @@
+package frontier
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func openDisk(t *testing.T, dir string, resume bool) (*DiskFrontier, []string) {
+	t.Helper()
+
+	var seen []string
+	q, err := OpenDiskFrontier(dir, NewFrontier(0, nil), resume, func(url string) {
+		seen = append(seen, url)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q, seen
+}
+
+func journal(t *testing.T, dir string) []string {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func drain(q URLFrontier) []string {
+	var urls []string
+	for {
+		item, ok := q.TryPop()
+		if !ok {
+			return urls
+		}
+		urls = append(urls, item.Url)
+	}
+}
+
+func TestDiskFrontierCompact(t *testing.T) {
+	dir := t.TempDir()
+	q, _ := openDisk(t, dir, false)
+
+	for _, url := range []string{"http://a.test/1", "http://a.test/2", "http://a.test/3", "http://b.test/1"} {
+		q.Push(Item{Url: url})
+	}
+	// ONE URL CRAWLED, ONE IN FLIGHT, TWO STILL QUEUED
+	for _, url := range []string{"http://a.test/1", "http://b.test/1"} {
+		if item, ok := q.TryPop(); !ok || item.Url != url {
+			t.Fatalf("TryPop = %q, %v, want %q", item.Url, ok, url)
+		}
+	}
+	q.Complete("http://a.test/1")
+
+	if err := q.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"T\t1", "P\t0\thttp://a.test/2", "P\t0\thttp://a.test/3", "P\t0\thttp://b.test/1"}
+	if got := journal(t, dir); !slices.Equal(got, want) {
+		t.Errorf("compacted journal = %q, want %q", got, want)
+	}
+
+	// RECORDS WRITTEN AFTER THE COMPACTION LAND IN THE NEW JOURNAL
+	q.Complete("http://b.test/1")
+	q.Close()
+
+	resumed, seen := openDisk(t, dir, true)
+	if got := resumed.TotalProcessedUrls(); got != 2 {
+		t.Errorf("TotalProcessedUrls after resume = %d, want 2", got)
+	}
+	if got, want := drain(resumed), []string{"http://a.test/2", "http://a.test/3"}; !slices.Equal(got, want) {
+		t.Errorf("pending after resume = %q, want %q", got, want)
+	}
+	if want := []string{"http://a.test/2", "http://a.test/3", "http://b.test/1"}; !slices.Equal(seen, want) {
+		t.Errorf("seen after resume = %q, want %q", seen, want)
+	}
+}
+
+func TestDiskFrontierJournalsRevisits(t *testing.T) {
+	dir := t.TempDir()
+	q, _ := openDisk(t, dir, false)
+
+	q.Push(Item{Url: "http://a.test/1"})
+	q.TryPop()
+	q.Complete("http://a.test/1")
+	if err := q.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// THE REVISITED URL IS NO LONGER IN THE COMPACTED JOURNAL, AND IS
+	// REVISITED AGAIN AFTER A COMPLETED ONE
+	q.Revisit(Item{Url: "http://a.test/1", Depth: 1})
+	q.Push(Item{Url: "http://a.test/2"})
+	q.TryPop()
+	q.Complete("http://a.test/2")
+	q.Revisit(Item{Url: "http://a.test/2", Depth: 2})
+	q.Close()
+
+	resumed, _ := openDisk(t, dir, true)
+	if got := resumed.TotalProcessedUrls(); got != 2 {
+		t.Errorf("TotalProcessedUrls after resume = %d, want 2", got)
+	}
+	var got []Item
+	for {
+		item, ok := resumed.TryPop()
+		if !ok {
+			break
+		}
+		got = append(got, item)
+	}
+	want := []Item{{Url: "http://a.test/1", Depth: 1}, {Url: "http://a.test/2", Depth: 2}}
+	if !slices.Equal(got, want) {
+		t.Errorf("pending after resume = %+v, want %+v", got, want)
+	}
+}
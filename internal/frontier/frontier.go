@@ -1,46 +1,290 @@
 package frontier
 
-import "sync"
+import (
+	"container/heap"
+	url2 "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URLFrontier is what the crawlers need from a frontier implementation.
+type URLFrontier interface {
+	Push(item Item)
+	// Pop waits for an item to be ready, it reports false when the frontier
+	// is empty. TryPop does not wait.
+	Pop() (Item, bool)
+	TryPop() (Item, bool)
+	Complete(url string)
+	Retry(item Item)
+	Revisit(item Item)
+	ObserveLink(url string)
+	SetCrawlDelay(url string, delay time.Duration)
+	Size() int
+	TotalProcessedUrls() int
+}
+
+type entry struct {
+	item     Item
+	host     string
+	priority float64
+	seq      uint64
+	index    int
+}
+
+// entryHeap orders a host's queued items by priority, then by insertion order.
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+// delayedHeap orders the items waiting for their NotBefore time.
+type delayedHeap []Item
+
+func (h delayedHeap) Len() int { return len(h) }
+
+func (h delayedHeap) Less(i, j int) bool {
+	return h[i].NotBefore.Before(h[j].NotBefore)
+}
+
+func (h delayedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *delayedHeap) Push(x any) {
+	*h = append(*h, x.(Item))
+}
+
+func (h *delayedHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+type hostQueue struct {
+	items  entryHeap
+	nextAt time.Time
+}
 
 type Frontier struct {
 	TotalProcessed int
 	Length         int
-	Items          []string
+	Delay          time.Duration
+	Prioritizer    Prioritizer
+	hosts          map[string]*hostQueue
+	crawlDelays    map[string]time.Duration
+	idle           []string
+	queued         map[string]*entry
+	delayed        delayedHeap
+	waiting        map[string]bool
+	active         []string
+	cursor         int
+	seq            uint64
 	mu             sync.Mutex
 }
 
+func NewFrontier(delay time.Duration, prioritizer Prioritizer) *Frontier {
+	if prioritizer == nil {
+		prioritizer = FIFOPrioritizer{}
+	}
+
+	return &Frontier{
+		Delay:       delay,
+		Prioritizer: prioritizer,
+		hosts:       make(map[string]*hostQueue),
+		crawlDelays: make(map[string]time.Duration),
+		queued:      make(map[string]*entry),
+		waiting:     make(map[string]bool),
+	}
+}
+
 func (q *Frontier) Enqueue(url string) {
+	q.Push(Item{Url: url})
+}
+
+// Push queues an item. An item whose NotBefore is still ahead waits aside
+// until then.
+func (q *Frontier) Push(item Item) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	q.Items = append(q.Items, url)
+
+	if _, ok := q.queued[item.Url]; ok || q.waiting[item.Url] {
+		return
+	}
+
+	if time.Now().Before(item.NotBefore) {
+		heap.Push(&q.delayed, item)
+		q.waiting[item.Url] = true
+		q.Length++
+		return
+	}
+	q.push(item)
 	q.Length++
 }
 
-func (q *Frontier) Dequeue() string {
+// Retry puts a dequeued item back, to be popped again no sooner than its
+// NotBefore time. The retried url no longer counts as processed.
+func (q *Frontier) Retry(item Item) {
+	q.mu.Lock()
+	q.TotalProcessed--
+	q.mu.Unlock()
+
+	q.Push(item)
+}
+
+// Revisit queues again a url crawled before, for a recrawl.
+func (q *Frontier) Revisit(item Item) {
+	q.Push(item)
+}
+
+func (q *Frontier) push(item Item) {
+	priority := q.Prioritizer.Priority(item)
+
+	host := hostOf(item.Url)
+	h := q.hostQueue(host)
+	if h.items.Len() == 0 {
+		q.active = append(q.active, host)
+	}
+
+	e := &entry{item: item, host: host, priority: priority, seq: q.seq}
+	q.seq++
+	heap.Push(&h.items, e)
+	q.queued[item.Url] = e
+}
+
+// ObserveLink feeds a discovered link to the prioritizer and re-scores the
+// link if it is still waiting in the frontier.
+func (q *Frontier) ObserveLink(url string) {
+	observer, ok := q.Prioritizer.(LinkObserver)
+	if !ok {
+		return
+	}
+	observer.ObserveLink(url)
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	url := q.Items[0]
-	q.Items = q.Items[1:]
-	q.Length--
-	q.TotalProcessed++
 
-	return url
+	e, ok := q.queued[url]
+	if !ok {
+		return
+	}
+	e.priority = q.Prioritizer.Priority(e.item)
+	heap.Fix(&q.hosts[e.host].items, e.index)
+}
+
+// Dequeue blocks until a host becomes eligible. It returns an empty string
+// when the frontier is empty.
+func (q *Frontier) Dequeue() string {
+	item, _ := q.Pop()
+	return item.Url
+}
+
+func (q *Frontier) Pop() (Item, bool) {
+	for {
+		item, ok := q.TryPop()
+		if ok {
+			return item, true
+		}
+
+		wait, ok := q.nextReadyIn()
+		if !ok {
+			return Item{}, false
+		}
+		time.Sleep(wait)
+	}
 }
 
 func (q *Frontier) TryDequeue() (string, bool) {
+	item, ok := q.TryPop()
+	return item.Url, ok
+}
+
+func (q *Frontier) TryPop() (Item, bool) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	if q.Length == 0 {
-		return "", false
+		return Item{}, false
+	}
+
+	// AMONG ELIGIBLE HOSTS THE HIGHEST PRIORITY WINS, TIES GO ROUND-ROBIN SO A
+	// SINGLE BUSY HOST CAN'T STARVE THE OTHERS
+	now := time.Now()
+	q.prune(now)
+	q.promote(now)
+	best := -1
+	for i := 0; i < len(q.active); i++ {
+		idx := (q.cursor + i) % len(q.active)
+		h := q.hosts[q.active[idx]]
+		if now.Before(h.nextAt) {
+			continue
+		}
+		if best == -1 || h.items[0].priority > q.hosts[q.active[best]].items[0].priority {
+			best = idx
+		}
+	}
+	if best == -1 {
+		return Item{}, false
+	}
+
+	host := q.active[best]
+	h := q.hosts[host]
+	e := heap.Pop(&h.items).(*entry)
+	h.nextAt = now.Add(q.delayFor(host))
+	if h.items.Len() == 0 {
+		q.active = append(q.active[:best], q.active[best+1:]...)
+		q.idle = append(q.idle, host)
+		q.cursor = best
+	} else {
+		q.cursor = best + 1
 	}
 
-	url := q.Items[0]
-	q.Items = q.Items[1:]
+	delete(q.queued, e.item.Url)
 	q.Length--
 	q.TotalProcessed++
 
-	return url, true
+	return e.item, true
+}
+
+// Complete marks a dequeued url as crawled. The in-memory frontier forgets
+// urls as soon as they are dequeued, so there is nothing left to do.
+func (q *Frontier) Complete(url string) {}
+
+// SetCrawlDelay overrides the default politeness delay for the host of the
+// given URL, e.g. with the robots.txt `Crawl-delay` directive.
+func (q *Frontier) SetCrawlDelay(url string, delay time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.crawlDelays[hostOf(url)] = delay
 }
 
 func (q *Frontier) Size() int {
@@ -54,3 +298,81 @@ func (q *Frontier) TotalProcessedUrls() int {
 	defer q.mu.Unlock()
 	return q.TotalProcessed
 }
+
+func (q *Frontier) nextReadyIn() (time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.Length == 0 {
+		return 0, false
+	}
+
+	now := time.Now()
+	wait := time.Duration(-1)
+	for _, host := range q.active {
+		w := q.hosts[host].nextAt.Sub(now)
+		if wait < 0 || w < wait {
+			wait = w
+		}
+	}
+	if q.delayed.Len() > 0 {
+		w := q.delayed[0].NotBefore.Sub(now)
+		if wait < 0 || w < wait {
+			wait = w
+		}
+	}
+
+	return max(wait, 0), true
+}
+
+// promote moves the delayed items that are due into their host queues.
+func (q *Frontier) promote(now time.Time) {
+	for q.delayed.Len() > 0 && !now.Before(q.delayed[0].NotBefore) {
+		item := heap.Pop(&q.delayed).(Item)
+		delete(q.waiting, item.Url)
+		q.push(item)
+	}
+}
+
+// prune forgets the hosts whose queue ran empty once their politeness delay
+// has passed, so a broad crawl doesn't keep a queue for every host it has
+// ever seen. A host queued again in the meantime is no longer idle.
+func (q *Frontier) prune(now time.Time) {
+	kept := q.idle[:0]
+	for _, host := range q.idle {
+		h, ok := q.hosts[host]
+		switch {
+		case !ok || h.items.Len() > 0:
+		case now.Before(h.nextAt):
+			kept = append(kept, host)
+		default:
+			delete(q.hosts, host)
+		}
+	}
+	clear(q.idle[len(kept):])
+	q.idle = kept
+}
+
+func (q *Frontier) hostQueue(host string) *hostQueue {
+	h, ok := q.hosts[host]
+	if !ok {
+		h = &hostQueue{}
+		q.hosts[host] = h
+	}
+	return h
+}
+
+func (q *Frontier) delayFor(host string) time.Duration {
+	if delay := q.crawlDelays[host]; delay > 0 {
+		return delay
+	}
+	return q.Delay
+}
+
+func hostOf(url string) string {
+	u, err := url2.Parse(url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
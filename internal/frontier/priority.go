@@ -0,0 +1,156 @@
+package frontier
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Item struct {
+	Url   string
+	Depth int
+	// Attempts counts the failed fetches of a retried url, NotBefore is the
+	// earliest time it may be popped again. The zero time means right away.
+	Attempts  int
+	NotBefore time.Time
+}
+
+// Prioritizer scores frontier items, higher scores are crawled first.
+type Prioritizer interface {
+	Priority(item Item) float64
+}
+
+// LinkObserver is implemented by prioritizers that need to see every
+// discovered link, including the ones that are already queued or crawled.
+type LinkObserver interface {
+	ObserveLink(url string)
+}
+
+type FIFOPrioritizer struct{}
+
+func (FIFOPrioritizer) Priority(Item) float64 {
+	return 0
+}
+
+type DepthPrioritizer struct{}
+
+func (DepthPrioritizer) Priority(item Item) float64 {
+	return -float64(item.Depth)
+}
+
+type InLinkPrioritizer struct {
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+func NewInLinkPrioritizer() *InLinkPrioritizer {
+	return &InLinkPrioritizer{counts: make(map[string]int)}
+}
+
+func (p *InLinkPrioritizer) ObserveLink(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[url]++
+}
+
+func (p *InLinkPrioritizer) Priority(item Item) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return float64(p.counts[item.Url])
+}
+
+type DomainPrioritizer struct {
+	Weights map[string]float64
+}
+
+func (p *DomainPrioritizer) Priority(item Item) float64 {
+	host := hostOf(item.Url)
+
+	// THE MOST SPECIFIC (LONGEST) MATCHING DOMAIN WINS
+	weight := 0.0
+	longest := 0
+	for domain, w := range p.Weights {
+		if (host == domain || strings.HasSuffix(host, "."+domain)) && len(domain) > longest {
+			weight = w
+			longest = len(domain)
+		}
+	}
+
+	return weight
+}
+
+type PatternRule struct {
+	Pattern *regexp.Regexp
+	Weight  float64
+}
+
+type PatternPrioritizer struct {
+	Rules []PatternRule
+}
+
+func (p *PatternPrioritizer) Priority(item Item) float64 {
+	weight := 0.0
+	for _, rule := range p.Rules {
+		if rule.Pattern.MatchString(item.Url) {
+			weight += rule.Weight
+		}
+	}
+
+	return weight
+}
+
+// NewPrioritizer builds a prioritizer by name. Domain and pattern
+// prioritizers take `key=weight` rules, e.g. `wikipedia.org=2`.
+func NewPrioritizer(name string, rules []string) (Prioritizer, error) {
+	switch name {
+	case "", "fifo":
+		return FIFOPrioritizer{}, nil
+	case "depth":
+		return DepthPrioritizer{}, nil
+	case "inlinks":
+		return NewInLinkPrioritizer(), nil
+	case "domain":
+		weights := make(map[string]float64, len(rules))
+		for _, r := range rules {
+			key, weight, err := parseWeightedRule(r)
+			if err != nil {
+				return nil, err
+			}
+			weights[strings.ToLower(key)] = weight
+		}
+		return &DomainPrioritizer{Weights: weights}, nil
+	case "pattern":
+		patterns := make([]PatternRule, 0, len(rules))
+		for _, r := range rules {
+			key, weight, err := parseWeightedRule(r)
+			if err != nil {
+				return nil, err
+			}
+			re, err := regexp.Compile(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid priority pattern `%s`: %w", key, err)
+			}
+			patterns = append(patterns, PatternRule{Pattern: re, Weight: weight})
+		}
+		return &PatternPrioritizer{Rules: patterns}, nil
+	default:
+		return nil, fmt.Errorf("unknown prioritizer `%s`", name)
+	}
+}
+
+func parseWeightedRule(rule string) (string, float64, error) {
+	idx := strings.LastIndex(rule, "=")
+	if idx <= 0 {
+		return "", 0, fmt.Errorf("invalid priority rule `%s`, expected key=weight", rule)
+	}
+
+	weight, err := strconv.ParseFloat(strings.TrimSpace(rule[idx+1:]), 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid weight in priority rule `%s`: %w", rule, err)
+	}
+
+	return strings.TrimSpace(rule[:idx]), weight, nil
+}
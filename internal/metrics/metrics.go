@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 	"web-spider/internal/filter"
@@ -11,15 +12,40 @@ import (
 )
 
 type CrawlerStats struct {
-	TotalSeen             int
-	UniqueEnqueued        int
-	DBInsertAttempts      int
-	DBInserted            int
-	FailedInserts         int
-	HTMLPages             int
-	EmptyPages            int
-	SkippedDuplicates     int
-	HTTPErrors            int
+	TotalSeen         int
+	UniqueEnqueued    int
+	DBInsertAttempts  int
+	DBInserted        int
+	FailedInserts     int
+	HTMLPages         int
+	EmptyPages        int
+	SkippedDuplicates int
+	SkippedDisallowed int
+	HTTPErrors        int
+	RedirectedPages   int
+	NotModifiedPages  int
+	RevisitedPages    int
+	ChangedPages      int
+	UnchangedPages    int
+	ExactDuplicates   int
+	NearDuplicates    int
+	TruncatedPages    int
+	OversizedPages    int
+	CompressedPages   int
+	CompressionBombs  int
+	WireBytes         int64
+	DecodedBytes      int64
+	// OUT OF SCOPE SKIPS, ONE COUNTER PER REJECTION REASON
+	SkippedDomainNotAllowed int
+	SkippedDomainBlocked    int
+	SkippedNotIncluded      int
+	SkippedExcluded         int
+	SkippedTooDeep          int
+	SkippedHostLimit        int
+	SkippedBlockedExtension int
+	// RETRIES PER HTTP STATUS CODE, 0 STANDS FOR NETWORK ERRORS
+	Retries               map[int]int
+	RetriesExhausted      int
 	PagesPerMinute        string
 	CrawledRatioPerMinute string
 	StartedAt             time.Time
@@ -28,7 +54,7 @@ type CrawlerStats struct {
 }
 
 func NewCrawlerStats() *CrawlerStats {
-	return &CrawlerStats{StartedAt: time.Now()}
+	return &CrawlerStats{StartedAt: time.Now(), Retries: make(map[int]int)}
 }
 
 func (c *CrawlerStats) EndCrawl() {
@@ -79,13 +105,43 @@ func (c *CrawlerStats) DuplicatesSkipRate() float64 {
 	return utils.SafeDivide(c.SkippedDuplicates, c.TotalSeen)
 }
 
+func (c *CrawlerStats) DisallowedSkipRate() float64 {
+	c.MU.Lock()
+	defer c.MU.Unlock()
+	return utils.SafeDivide(c.SkippedDisallowed, c.TotalSeen)
+}
+
+func (c *CrawlerStats) OutOfScopeSkips() int {
+	c.MU.Lock()
+	defer c.MU.Unlock()
+	return c.SkippedDomainNotAllowed + c.SkippedDomainBlocked + c.SkippedNotIncluded + c.SkippedExcluded +
+		c.SkippedTooDeep + c.SkippedHostLimit + c.SkippedBlockedExtension
+}
+
+// BandwidthSavings is the share of the decoded bytes content codings saved
+// on the wire.
+func (c *CrawlerStats) BandwidthSavings() float64 {
+	c.MU.Lock()
+	defer c.MU.Unlock()
+	if c.DecodedBytes == 0 {
+		return 0
+	}
+	return 1 - float64(c.WireBytes)/float64(c.DecodedBytes)
+}
+
+func (c *CrawlerStats) NotModifiedRate() float64 {
+	c.MU.Lock()
+	defer c.MU.Unlock()
+	return utils.SafeDivide(c.NotModifiedPages, c.TotalSeen)
+}
+
 func (c *CrawlerStats) StorageYield() float64 {
 	c.MU.Lock()
 	defer c.MU.Unlock()
 	return utils.SafeDivide(c.DBInserted, c.TotalSeen)
 }
 
-func (c *CrawlerStats) CrawlingPerMinuteRate(q *frontier.Frontier, s *filter.UrlSet, t time.Time) {
+func (c *CrawlerStats) CrawlingPerMinuteRate(q frontier.URLFrontier, s filter.SeenSet, t time.Time) {
 	c.MU.Lock()
 	defer c.MU.Unlock()
 	c.PagesPerMinute += fmt.Sprintf("%f %d\n", t.Sub(c.StartedAt).Minutes(), s.Size())
@@ -100,11 +156,83 @@ func (c *CrawlerStats) PrintGeneralStats() {
 	fmt.Printf("HTML Page Ratio: %.2f\n", c.HTMLPagesRatio())
 	fmt.Printf("Empty Page Rate: %.2f\n", c.EmptyPagesRate())
 	fmt.Printf("Duplicate Skip Rate: %.2f\n", c.DuplicatesSkipRate())
+	fmt.Printf("Robots.txt Disallowed Skip Rate: %.2f\n", c.DisallowedSkipRate())
 	fmt.Printf("Error Rate (HTTP): %.2f\n", c.HTTPErrorRate())
 	fmt.Printf("Storage Yield: %.2f\n", c.StorageYield())
+	fmt.Printf("Unchanged Page Rate (304): %.2f\n", c.NotModifiedRate())
+	fmt.Printf("Bandwidth Savings (compression): %.2f\n", c.BandwidthSavings())
 	logger.Info("\n------------------END CRAWLING GENERAL STATS PRINTING.")
 }
 
+func (c *CrawlerStats) PrintScopeStats() {
+	total := c.OutOfScopeSkips()
+
+	c.MU.Lock()
+	defer c.MU.Unlock()
+	logger.Info("\n------------------BEGIN CRAWL SCOPE STATS PRINTING:")
+	fmt.Printf("Out Of Scope Skips: %d\n", total)
+	fmt.Printf("Domain Not Allowed: %d\n", c.SkippedDomainNotAllowed)
+	fmt.Printf("Domain Blocked: %d\n", c.SkippedDomainBlocked)
+	fmt.Printf("No Include Pattern Matched: %d\n", c.SkippedNotIncluded)
+	fmt.Printf("Exclude Pattern Matched: %d\n", c.SkippedExcluded)
+	fmt.Printf("Too Deep: %d\n", c.SkippedTooDeep)
+	fmt.Printf("Host Page Limit Reached: %d\n", c.SkippedHostLimit)
+	fmt.Printf("Blocked Extension: %d\n", c.SkippedBlockedExtension)
+	logger.Info("\n------------------END CRAWL SCOPE STATS PRINTING.")
+}
+
+func (c *CrawlerStats) PrintRetryStats() {
+	c.MU.Lock()
+	defer c.MU.Unlock()
+
+	codes := make([]int, 0, len(c.Retries))
+	for code := range c.Retries {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	logger.Info("\n------------------BEGIN RETRY STATS PRINTING:")
+	for _, code := range codes {
+		if code == 0 {
+			fmt.Printf("Retries after a network error: %d\n", c.Retries[code])
+		} else {
+			fmt.Printf("Retries after HTTP %d: %d\n", code, c.Retries[code])
+		}
+	}
+	fmt.Printf("Given up after the last attempt: %d\n", c.RetriesExhausted)
+	logger.Info("\n------------------END RETRY STATS PRINTING.")
+}
+
+func (c *CrawlerStats) PrintDedupStats() {
+	c.MU.Lock()
+	defer c.MU.Unlock()
+	logger.Info("\n------------------BEGIN DUPLICATE CONTENT STATS PRINTING:")
+	fmt.Printf("Exact Duplicates: %d\n", c.ExactDuplicates)
+	fmt.Printf("Near Duplicates: %d\n", c.NearDuplicates)
+	fmt.Printf("Duplicate Rate: %.2f\n", utils.SafeDivide(c.ExactDuplicates+c.NearDuplicates, c.HTMLPages))
+	logger.Info("\n------------------END DUPLICATE CONTENT STATS PRINTING.")
+}
+
+func (c *CrawlerStats) PrintRecrawlStats() {
+	c.MU.Lock()
+	defer c.MU.Unlock()
+	logger.Info("\n------------------BEGIN RECRAWL STATS PRINTING:")
+	fmt.Printf("Due Pages Revisited: %d\n", c.RevisitedPages)
+	fmt.Printf("Changed Since Last Crawl: %d\n", c.ChangedPages)
+	fmt.Printf("Unchanged Since Last Crawl: %d\n", c.UnchangedPages)
+	fmt.Printf("Of Which Not Modified (304): %d\n", c.NotModifiedPages)
+	fmt.Printf("Change Rate: %.2f\n", utils.SafeDivide(c.ChangedPages, c.ChangedPages+c.UnchangedPages))
+	logger.Info("\n------------------END RECRAWL STATS PRINTING.")
+}
+
+func (c *CrawlerStats) PrintSeenSetStats(s filter.SeenSet) {
+	logger.Info("\n------------------BEGIN SEEN SET STATS PRINTING:")
+	fmt.Printf("Seen URLs: %d\n", s.Size())
+	fmt.Printf("Estimated False Positive Rate: %.6f\n", s.EstimatedFalsePositiveRate())
+	fmt.Printf("Memory Use: %.2f MiB\n", float64(s.MemoryBytes())/(1024*1024))
+	logger.Info("\n------------------END SEEN SET STATS PRINTING.")
+}
+
 func (c *CrawlerStats) PrintTimingStats() {
 	c.MU.Lock()
 	defer c.MU.Unlock()
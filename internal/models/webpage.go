@@ -1,8 +1,104 @@
 package models
 
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"time"
+)
+
+// Redirect is one hop of a redirect chain: Url answered StatusCode with a
+// Location header pointing to Location.
+type Redirect struct {
+	Url        string `bson:"url" json:"url"`
+	StatusCode int    `bson:"statusCode" json:"statusCode"`
+	Location   string `bson:"location" json:"location"`
+}
+
+// Link is an outgoing link of a page: Href as written in the page, Url as
+// resolved and normalized, with the anchor Text and Title, the Rel values, and
+// its Position among the page's links.
+type Link struct {
+	Href     string   `bson:"href" json:"href"`
+	Url      string   `bson:"url" json:"url"`
+	Text     string   `bson:"text,omitempty" json:"text,omitempty"`
+	Title    string   `bson:"title,omitempty" json:"title,omitempty"`
+	Rel      []string `bson:"rel,omitempty" json:"rel,omitempty"`
+	Internal bool     `bson:"internal" json:"internal"`
+	Nofollow bool     `bson:"nofollow,omitempty" json:"nofollow,omitempty"`
+	Position int      `bson:"position" json:"position"`
+}
+
+// UnmarshalBSONValue also reads the bare url strings links were stored as
+// before their anchors were recorded.
+func (l *Link) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	if url, ok := raw.StringValueOK(); ok {
+		*l = Link{Href: url, Url: url}
+		return nil
+	}
+
+	type plain Link
+	return raw.Unmarshal((*plain)(l))
+}
+
+// Headings are the texts of a page's h1 to h3 elements, in document order.
+type Headings struct {
+	H1 []string `bson:"h1,omitempty" json:"h1,omitempty"`
+	H2 []string `bson:"h2,omitempty" json:"h2,omitempty"`
+	H3 []string `bson:"h3,omitempty" json:"h3,omitempty"`
+}
+
+// OpenGraph holds the `og:*` meta properties of a page.
+type OpenGraph struct {
+	Title       string `bson:"title,omitempty" json:"title,omitempty"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	Type        string `bson:"type,omitempty" json:"type,omitempty"`
+	Url         string `bson:"url,omitempty" json:"url,omitempty"`
+	Image       string `bson:"image,omitempty" json:"image,omitempty"`
+	SiteName    string `bson:"siteName,omitempty" json:"siteName,omitempty"`
+}
+
+// TwitterCard holds the `twitter:*` meta tags of a page.
+type TwitterCard struct {
+	Card        string `bson:"card,omitempty" json:"card,omitempty"`
+	Title       string `bson:"title,omitempty" json:"title,omitempty"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	Image       string `bson:"image,omitempty" json:"image,omitempty"`
+	Site        string `bson:"site,omitempty" json:"site,omitempty"`
+}
+
+// WebPage is a crawled page. StructuredData holds its schema.org items as
+// JSON-LD objects, queryable by `@type`.
 type WebPage struct {
-	Url   string   `bson:"url" json:"url"`
-	Title string   `bson:"title" json:"title"`
-	Text  string   `bson:"text" json:"text"`
-	Links []string `bson:"links" json:"links"`
+	Url             string           `bson:"url" json:"url"`
+	OriginalUrl     string           `bson:"originalUrl,omitempty" json:"originalUrl,omitempty"`
+	Redirects       []Redirect       `bson:"redirects,omitempty" json:"redirects,omitempty"`
+	CanonicalUrl    string           `bson:"canonicalUrl,omitempty" json:"canonicalUrl,omitempty"`
+	Title           string           `bson:"title" json:"title"`
+	Description     string           `bson:"description,omitempty" json:"description,omitempty"`
+	Keywords        []string         `bson:"keywords,omitempty" json:"keywords,omitempty"`
+	Lang            string           `bson:"lang,omitempty" json:"lang,omitempty"`
+	Headings        Headings         `bson:"headings" json:"headings"`
+	OpenGraph       *OpenGraph       `bson:"openGraph,omitempty" json:"openGraph,omitempty"`
+	TwitterCard     *TwitterCard     `bson:"twitterCard,omitempty" json:"twitterCard,omitempty"`
+	StructuredData  []map[string]any `bson:"structuredData,omitempty" json:"structuredData,omitempty"`
+	Text            string           `bson:"text" json:"text"`
+	Links           []Link           `bson:"links" json:"links"`
+	StatusCode      int              `bson:"statusCode" json:"statusCode"`
+	ContentType     string           `bson:"contentType,omitempty" json:"contentType,omitempty"`
+	Charset         string           `bson:"charset,omitempty" json:"charset,omitempty"`
+	ContentLength   int64            `bson:"contentLength" json:"contentLength"`
+	Truncated       bool             `bson:"truncated,omitempty" json:"truncated,omitempty"`
+	ResponseTime    time.Duration    `bson:"responseTime" json:"responseTime"`
+	ETag            string           `bson:"etag,omitempty" json:"etag,omitempty"`
+	LastModified    string           `bson:"lastModified,omitempty" json:"lastModified,omitempty"`
+	FetchedAt       time.Time        `bson:"fetchedAt" json:"fetchedAt"`
+	LastCheckedAt   time.Time        `bson:"lastCheckedAt" json:"lastCheckedAt"`
+	Depth           int              `bson:"depth" json:"depth"`
+	ContentHash     string           `bson:"contentHash,omitempty" json:"contentHash,omitempty"`
+	TextHash        string           `bson:"textHash,omitempty" json:"textHash,omitempty"`
+	SimHash         string           `bson:"simHash,omitempty" json:"simHash,omitempty"`
+	DuplicateOf     string           `bson:"duplicateOf,omitempty" json:"duplicateOf,omitempty"`
+	RevisitInterval time.Duration    `bson:"revisitInterval,omitempty" json:"revisitInterval,omitempty"`
+	NextVisitAt     time.Time        `bson:"nextVisitAt,omitempty" json:"nextVisitAt,omitempty"`
 }
@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"golang.org/x/net/html"
+	url2 "net/url"
+	"strings"
+	"web-spider/internal/models"
+)
+
+// pageMeta is what the `<meta>` tags of a page tell about it.
+type pageMeta struct {
+	description string
+	keywords    []string
+	openGraph   *models.OpenGraph
+	twitterCard *models.TwitterCard
+}
+
+func extractMeta(doc *html.Node, base *url2.URL) pageMeta {
+	var meta pageMeta
+	og := &models.OpenGraph{}
+	twitter := &models.TwitterCard{}
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "meta" {
+			// OPEN GRAPH USES property=, TWITTER CARDS name=, BOTH ARE MIXED UP IN THE WILD
+			key := strings.ToLower(strings.TrimSpace(attr(n, "property")))
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attr(n, "name")))
+			}
+			content := strings.TrimSpace(attr(n, "content"))
+
+			switch key {
+			case "description":
+				setOnce(&meta.description, content)
+			case "keywords":
+				if meta.keywords == nil {
+					meta.keywords = splitKeywords(content)
+				}
+			case "og:title":
+				setOnce(&og.Title, content)
+			case "og:description":
+				setOnce(&og.Description, content)
+			case "og:type":
+				setOnce(&og.Type, content)
+			case "og:url":
+				setOnce(&og.Url, resolveUrl(base, content))
+			case "og:image", "og:image:url":
+				setOnce(&og.Image, resolveUrl(base, content))
+			case "og:site_name":
+				setOnce(&og.SiteName, content)
+			case "twitter:card":
+				setOnce(&twitter.Card, content)
+			case "twitter:title":
+				setOnce(&twitter.Title, content)
+			case "twitter:description":
+				setOnce(&twitter.Description, content)
+			case "twitter:image", "twitter:image:src":
+				setOnce(&twitter.Image, resolveUrl(base, content))
+			case "twitter:site":
+				setOnce(&twitter.Site, content)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	if *og != (models.OpenGraph{}) {
+		meta.openGraph = og
+	}
+	if *twitter != (models.TwitterCard{}) {
+		meta.twitterCard = twitter
+	}
+	return meta
+}
+
+func extractHeadings(doc *html.Node) models.Headings {
+	var headings models.Headings
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			var level *[]string
+			switch n.Data {
+			case "h1":
+				level = &headings.H1
+			case "h2":
+				level = &headings.H2
+			case "h3":
+				level = &headings.H3
+			}
+			if level != nil {
+				if text := nodeText(n); text != "" {
+					*level = append(*level, text)
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	return headings
+}
+
+// extractLang returns the `<html lang>` of the page, falling back to a
+// `Content-Language` meta tag.
+func extractLang(doc *html.Node) string {
+	n := findElement(doc, func(n *html.Node) bool {
+		return n.Data == "html"
+	})
+	if n != nil {
+		if lang := strings.TrimSpace(attr(n, "lang")); lang != "" {
+			return strings.ToLower(lang)
+		}
+	}
+
+	n = findElement(doc, func(n *html.Node) bool {
+		return n.Data == "meta" && strings.EqualFold(attr(n, "http-equiv"), "content-language")
+	})
+	if n == nil {
+		return ""
+	}
+	// THE HEADER MAY LIST SEVERAL LANGUAGES, THE FIRST ONE IS KEPT
+	lang, _, _ := strings.Cut(attr(n, "content"), ",")
+	return strings.ToLower(strings.TrimSpace(lang))
+}
+
+// nodeText is the whitespace-collapsed text under n.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func splitKeywords(content string) []string {
+	var keywords []string
+	for _, k := range strings.Split(content, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// resolveUrl makes a meta tag url absolute, leaving it as is if it can't be
+// parsed.
+func resolveUrl(base *url2.URL, href string) string {
+	ref, err := url2.Parse(href)
+	if err != nil || href == "" {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func setOnce(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
@@ -1,27 +1,83 @@
 package parser
 
 import (
-	"fmt"
 	"golang.org/x/net/html"
+	"io"
+	url2 "net/url"
+	"slices"
 	"strings"
+	"web-spider/internal/filter"
+	"web-spider/internal/fingerprint"
 	"web-spider/internal/models"
 )
 
-func ParseHTML(url, rawHTML string) (*models.WebPage, error) {
-	doc, err := html.Parse(strings.NewReader(rawHTML))
+const (
+	ExtractorFull        = "full"
+	ExtractorReadability = "readability"
+)
+
+type Options struct {
+	// Extractor picks how the page text is extracted: ExtractorFull keeps all
+	// the visible text, ExtractorReadability only the main content, falling
+	// back to the full text when none is found.
+	Extractor string
+	// MaxWords and MaxBytes cap the extracted text, 0 means unlimited.
+	MaxWords int
+	MaxBytes int
+}
+
+// ParseHTML builds the page straight from the body stream, errors reading it
+// included.
+func ParseHTML(url string, body io.Reader, opts Options) (*models.WebPage, error) {
+	doc, err := html.Parse(body)
 	if err != nil {
 		return nil, err
 	}
 
+	pageUrl, err := url2.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	base := extractBase(doc, pageUrl)
+
 	title := extractTitle(doc)
-	text := extractText(doc)
-	links := extractLinks(doc)
+	meta := extractMeta(doc, base)
+	var text string
+	if opts.Extractor == ExtractorReadability {
+		text = extractMainText(doc, opts)
+	} else {
+		text = extractText(doc, opts)
+	}
+	canonical := extractCanonical(doc, base)
+	links := extractLinks(doc, base, pageUrl)
+	hasCanonical := slices.ContainsFunc(links, func(l models.Link) bool {
+		return l.Url == canonical
+	})
+	if canonical != "" && canonical != url && !hasCanonical {
+		links = append(links, models.Link{
+			Href:     canonical,
+			Url:      canonical,
+			Rel:      []string{"canonical"},
+			Internal: sameSite(canonical, pageUrl),
+			Position: len(links),
+		})
+	}
 
 	wp := &models.WebPage{
-		Url:   url,
-		Title: title,
-		Text:  text,
-		Links: links,
+		Url:            url,
+		CanonicalUrl:   canonical,
+		Title:          title,
+		Description:    meta.description,
+		Keywords:       meta.keywords,
+		Lang:           extractLang(doc),
+		Headings:       extractHeadings(doc),
+		OpenGraph:      meta.openGraph,
+		TwitterCard:    meta.twitterCard,
+		StructuredData: extractStructuredData(doc, base),
+		Text:           text,
+		Links:          links,
+		TextHash:       fingerprint.TextHash(text),
+		SimHash:        fingerprint.Format(fingerprint.SimHash(text)),
 	}
 
 	return wp, nil
@@ -45,21 +101,40 @@ func extractTitle(doc *html.Node) string {
 	return title
 }
 
-func extractText(doc *html.Node) string {
-	var text string
-	var f func(*html.Node)
+// extractText returns all the visible text of the page, one line per block.
+func extractText(doc *html.Node, opts Options) string {
+	t := newTextBuilder(opts)
+	writeText(t, doc, func(n *html.Node) bool {
+		return isSkippableTag(n.Data)
+	})
+	return t.String()
+}
+
+// extractLinks returns the page's outgoing links in document order, once per
+// url. A page whose robots meta tag says nofollow has all its links marked
+// Nofollow, they are recorded but not crawled.
+func extractLinks(doc *html.Node, base *url2.URL, pageUrl *url2.URL) []models.Link {
+	var links []models.Link
+	nofollowAll := hasMetaRobots(doc, "nofollow")
 
-	tokensLimit := 0
+	seen := make(map[string]bool)
+	var f func(*html.Node)
 	f = func(n *html.Node) {
-		if n.Type == html.TextNode && !isDescendantOfSkippableTag(n) {
-			words := strings.Fields(n.Data)
-			for _, word := range words {
-				if tokensLimit >= 500 {
-					break
-				}
-
-				text = fmt.Sprintf("%s %s", text, word)
-				tokensLimit++
+		if n.Type == html.ElementNode && n.Data == "a" {
+			href := strings.TrimSpace(attr(n, "href"))
+			if link := resolveLink(base, href); link != "" && !seen[link] {
+				seen[link] = true
+				rel := strings.Fields(strings.ToLower(attr(n, "rel")))
+				links = append(links, models.Link{
+					Href:     href,
+					Url:      link,
+					Text:     nodeText(n),
+					Title:    strings.TrimSpace(attr(n, "title")),
+					Rel:      rel,
+					Internal: sameSite(link, pageUrl),
+					Nofollow: nofollowAll || slices.Contains(rel, "nofollow"),
+					Position: len(links),
+				})
 			}
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
@@ -68,19 +143,117 @@ func extractText(doc *html.Node) string {
 	}
 	f(doc)
 
-	return strings.TrimSpace(text)
+	return links
+}
+
+// sameSite tells whether a link points to the host of the page, with or
+// without its www. prefix.
+func sameSite(link string, pageUrl *url2.URL) bool {
+	u, err := url2.Parse(link)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimPrefix(u.Hostname(), "www."), strings.TrimPrefix(pageUrl.Hostname(), "www."))
+}
+
+// extractBase returns the url relative links are resolved against, which is
+// the page url unless the document declares a `<base href>`.
+func extractBase(doc *html.Node, pageUrl *url2.URL) *url2.URL {
+	n := findElement(doc, func(n *html.Node) bool {
+		return n.Data == "base" && attr(n, "href") != ""
+	})
+	if n == nil {
+		return pageUrl
+	}
+
+	href, err := url2.Parse(strings.TrimSpace(attr(n, "href")))
+	if err != nil {
+		return pageUrl
+	}
+	return pageUrl.ResolveReference(href)
+}
+
+func extractCanonical(doc *html.Node, base *url2.URL) string {
+	n := findElement(doc, func(n *html.Node) bool {
+		return n.Data == "link" && hasRel(n, "canonical")
+	})
+	if n == nil {
+		return ""
+	}
+	return resolveLink(base, attr(n, "href"))
+}
+
+// resolveLink turns an href into a normalized absolute http(s) url, or an
+// empty string for links that can't be crawled (mailto:, javascript:, ...).
+func resolveLink(base *url2.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+
+	ref, err := url2.Parse(href)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(ref)
+
+	scheme := strings.ToLower(resolved.Scheme)
+	if (scheme != "http" && scheme != "https") || resolved.Host == "" {
+		return ""
+	}
+
+	normalized, err := filter.NormalizeUrl(resolved.String())
+	if err != nil {
+		return ""
+	}
+	return normalized
 }
 
-func extractLinks(doc *html.Node) []string {
-	var links []string
+func hasMetaRobots(doc *html.Node, directive string) bool {
+	n := findElement(doc, func(n *html.Node) bool {
+		return n.Data == "meta" && strings.EqualFold(attr(n, "name"), "robots")
+	})
+	if n == nil {
+		return false
+	}
+
+	for _, d := range strings.Split(attr(n, "content"), ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == directive || d == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRel(n *html.Node, rel string) bool {
+	for _, r := range strings.Fields(attr(n, "rel")) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func findElement(doc *html.Node, match func(*html.Node) bool) *html.Node {
+	var found *html.Node
 	var f func(*html.Node)
 	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, attr := range n.Attr {
-				if attr.Key == "href" && strings.HasPrefix(attr.Val, "http") {
-					links = append(links, attr.Val)
-				}
-			}
+		if found != nil {
+			return
+		}
+		if n.Type == html.ElementNode && match(n) {
+			found = n
+			return
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			f(c)
@@ -88,18 +261,14 @@ func extractLinks(doc *html.Node) []string {
 	}
 	f(doc)
 
-	return links
+	return found
 }
 
-func isDescendantOfSkippableTag(n *html.Node) bool {
-	for p := n.Parent; p != nil; p = p.Parent {
-		if p.Type == html.ElementNode {
-			switch p.Data {
-			case "script", "style", "link", "head", "noscript", "template", "nav", "footer", "aside", "button",
-				"svg", "audio", "video", "form", "input", "select", "header", "option", "iframe", "canvas":
-				return true
-			}
-		}
+func isSkippableTag(tag string) bool {
+	switch tag {
+	case "script", "style", "link", "head", "noscript", "template", "nav", "footer", "aside", "button",
+		"svg", "audio", "video", "form", "input", "select", "header", "option", "iframe", "canvas":
+		return true
 	}
 	return false
 }
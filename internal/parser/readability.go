@@ -0,0 +1,246 @@
+package parser
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// minArticleLength is the text length below which the main content found is
+// not trusted and the full text is used instead.
+const minArticleLength = 250
+
+// minParagraphLength is the text length below which a paragraph does not
+// count towards its ancestors' scores.
+const minParagraphLength = 25
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|menu|modal|newsletter|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveHints      = regexp.MustCompile(`(?i)article|blog|body|content|entry|h-entry|hentry|main|page|post|story|text`)
+	negativeHints      = regexp.MustCompile(`(?i)-ad-|banner|combx|comment|com-|contact|foot|masthead|media|meta|outbrain|promo|related|scroll|share|shopping|shoutbox|sidebar|skyscraper|sponsor|tags|tool|widget`)
+)
+
+// readability finds the main content of a page the way Readability does:
+// paragraphs score their parent and grandparent by how much text and how many
+// commas they hold, the best scored element once penalized by its link
+// density is the article, along with its siblings scoring close enough.
+// Candidates holds the scored elements in the order they were first scored,
+// which breaks ties between equal scores the same way on every run.
+type readability struct {
+	scores     map[*html.Node]float64
+	candidates []*html.Node
+	unlikely   map[*html.Node]bool
+}
+
+func extractMainText(doc *html.Node, opts Options) string {
+	body := findElement(doc, func(n *html.Node) bool {
+		return n.Data == "body"
+	})
+	if body == nil {
+		return extractText(doc, opts)
+	}
+
+	r := &readability{
+		scores:   make(map[*html.Node]float64),
+		unlikely: make(map[*html.Node]bool),
+	}
+	r.scoreParagraphs(body)
+
+	top, topScore := r.topCandidate()
+	if top == nil {
+		return extractText(doc, opts)
+	}
+	text := r.articleText(top, topScore, opts)
+	if len(text) < minArticleLength {
+		return extractText(doc, opts)
+	}
+	return text
+}
+
+func (r *readability) scoreParagraphs(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || isBoilerplateTag(c.Data) {
+			continue
+		}
+		if isUnlikely(c) {
+			r.unlikely[c] = true
+			continue
+		}
+
+		if !isParagraph(c) {
+			r.scoreParagraphs(c)
+			continue
+		}
+		text := nodeText(c)
+		if len(text) < minParagraphLength {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		if parent := c.Parent; parent != nil && parent.Type == html.ElementNode {
+			r.addScore(parent, score)
+			if grandparent := parent.Parent; grandparent != nil && grandparent.Type == html.ElementNode {
+				r.addScore(grandparent, score/2)
+			}
+		}
+	}
+}
+
+func (r *readability) addScore(n *html.Node, score float64) {
+	if _, ok := r.scores[n]; !ok {
+		r.scores[n] = tagWeight(n) + classWeight(n)
+		r.candidates = append(r.candidates, n)
+	}
+	r.scores[n] += score
+}
+
+// topCandidate returns the best scored element once its score is scaled down
+// by its link density, a list of links being no article. Of equal scores the
+// first scored element wins.
+func (r *readability) topCandidate() (*html.Node, float64) {
+	var top *html.Node
+	var topScore float64
+	for _, n := range r.candidates {
+		score := r.scores[n] * (1 - linkDensity(n))
+		if top == nil || score > topScore {
+			top, topScore = n, score
+		}
+	}
+	return top, topScore
+}
+
+// articleText joins the text of the top candidate and of the siblings that
+// look like a part of the same article.
+func (r *readability) articleText(top *html.Node, topScore float64, opts Options) string {
+	threshold := max(10, topScore*0.2)
+
+	t := newTextBuilder(opts)
+	for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s.Type != html.ElementNode || r.unlikely[s] || !r.related(s, top, threshold) {
+			continue
+		}
+		t.breakLine()
+		writeText(t, s, r.skip)
+	}
+	return t.String()
+}
+
+func (r *readability) related(s, top *html.Node, threshold float64) bool {
+	if s == top {
+		return true
+	}
+	if score, ok := r.scores[s]; ok && score*(1-linkDensity(s)) >= threshold {
+		return true
+	}
+	if s.Data != "p" {
+		return false
+	}
+
+	text := nodeText(s)
+	density := linkDensity(s)
+	if len(text) > 80 {
+		return density < 0.25
+	}
+	return density == 0 && strings.HasSuffix(text, ".")
+}
+
+func (r *readability) skip(n *html.Node) bool {
+	return isBoilerplateTag(n.Data) || r.unlikely[n]
+}
+
+// isParagraph tells the elements holding running text: paragraphs, and the
+// containers used as paragraphs, which have no block children.
+func isParagraph(n *html.Node) bool {
+	switch n.Data {
+	case "p", "pre", "td":
+		return true
+	case "div", "section":
+		return findElement(n, func(c *html.Node) bool {
+			return c != n && isBlock(c.Data)
+		}) == nil
+	}
+	return false
+}
+
+func isBlock(tag string) bool {
+	switch tag {
+	case "address", "article", "aside", "blockquote", "dl", "div", "fieldset", "figure", "footer", "form",
+		"h1", "h2", "h3", "h4", "h5", "h6", "header", "main", "nav", "ol", "p", "pre", "section", "table", "ul":
+		return true
+	}
+	return false
+}
+
+func isBoilerplateTag(tag string) bool {
+	switch tag {
+	case "head", "title", "script", "style", "link", "noscript", "template", "nav", "footer", "aside", "button",
+		"svg", "audio", "video", "form", "input", "select", "option", "iframe", "canvas":
+		return true
+	}
+	return false
+}
+
+// isUnlikely tells the elements whose class or id names them as page chrome.
+func isUnlikely(n *html.Node) bool {
+	switch n.Data {
+	case "body", "article", "main":
+		return false
+	}
+	hints := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyCandidates.MatchString(hints) && !maybeCandidate.MatchString(hints)
+}
+
+func tagWeight(n *html.Node) float64 {
+	switch n.Data {
+	case "article":
+		return 10
+	case "div":
+		return 5
+	case "pre", "td", "blockquote":
+		return 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		return -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		return -5
+	}
+	return 0
+}
+
+func classWeight(n *html.Node) float64 {
+	var weight float64
+	for _, hint := range []string{attr(n, "class"), attr(n, "id")} {
+		if hint == "" {
+			continue
+		}
+		if negativeHints.MatchString(hint) {
+			weight -= 25
+		}
+		if positiveHints.MatchString(hint) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity is the share of an element's text that is link text.
+func linkDensity(n *html.Node) float64 {
+	text := len(nodeText(n))
+	if text == 0 {
+		return 0
+	}
+
+	links := 0
+	var f func(*html.Node)
+	f = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			links += len(nodeText(c))
+			return
+		}
+		for gc := c.FirstChild; gc != nil; gc = gc.NextSibling {
+			f(gc)
+		}
+	}
+	f(n)
+
+	return float64(links) / float64(text)
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the parser tests")
+
+// TestExtractMainText compares the main text extracted from every
+// testdata/*.html page with the testdata/*.golden file next to it. Run with
+// -update to rewrite the golden files after a deliberate change.
+func TestExtractMainText(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no testdata pages")
+	}
+
+	opts := Options{Extractor: ExtractorReadability}
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".html")
+		t.Run(name, func(t *testing.T) {
+			got := mainText(t, page, opts)
+
+			golden := strings.TrimSuffix(page, ".html") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("main text of %s differs from %s:\n--- got\n%s\n--- want\n%s", page, golden, got, want)
+			}
+
+			// TIES BETWEEN CANDIDATES MUST NOT DEPEND ON MAP ORDER
+			for i := 0; i < 20; i++ {
+				if again := mainText(t, page, opts); again != got {
+					t.Fatalf("run %d extracted a different text:\n%s", i, again)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractMainTextLeavesHeadOut(t *testing.T) {
+	got := mainText(t, filepath.Join("testdata", "body-paragraphs.html"), Options{Extractor: ExtractorReadability})
+	for _, head := range []string{"Release notes for version 2.0", "What changed in the crawler"} {
+		if strings.Contains(got, head) {
+			t.Errorf("main text holds `%s` from <head>:\n%s", head, got)
+		}
+	}
+}
+
+func mainText(t *testing.T, page string, opts Options) string {
+	t.Helper()
+
+	file, err := os.Open(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	wp, err := ParseHTML("https://example.com/"+filepath.Base(page), file, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wp.Text
+}
@@ -0,0 +1,267 @@
+package parser
+
+import (
+	"encoding/json"
+	"golang.org/x/net/html"
+	url2 "net/url"
+	"strings"
+)
+
+const schemaContext = "https://schema.org"
+
+// extractStructuredData returns the schema.org items of a page, from JSON-LD
+// blocks, Microdata and RDFa, all normalized to JSON-LD objects whose `@type`
+// is the bare schema.org type name (`Product`, not `https://schema.org/Product`)
+// whatever syntax it was marked up with.
+func extractStructuredData(doc *html.Node, base *url2.URL) []map[string]any {
+	var items []map[string]any
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "script" && strings.EqualFold(strings.TrimSpace(attr(n, "type")), "application/ld+json"):
+				items = append(items, jsonLDItems(scriptText(n))...)
+				return
+			// ONLY TOP-LEVEL ITEMS, NESTED ONES ARE PROPERTY VALUES OF THEIR PARENT
+			case hasAttr(n, "itemscope") && !hasAttr(n, "itemprop"):
+				items = append(items, microdataItem(n, base))
+				return
+			case hasAttr(n, "typeof") && !hasAttr(n, "property"):
+				items = append(items, rdfaItem(n, base))
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	return items
+}
+
+// jsonLDItems returns the objects of a JSON-LD block, the members of a
+// `@graph` inheriting the block's `@context`. Invalid blocks are ignored.
+func jsonLDItems(block string) []map[string]any {
+	var value any
+	if err := json.Unmarshal([]byte(block), &value); err != nil {
+		return nil
+	}
+
+	var items []map[string]any
+	var f func(value any, context any)
+	f = func(value any, context any) {
+		switch v := value.(type) {
+		case []any:
+			for _, e := range v {
+				f(e, context)
+			}
+		case map[string]any:
+			if c, ok := v["@context"]; ok {
+				context = c
+			}
+			if graph, ok := v["@graph"]; ok {
+				f(graph, context)
+				return
+			}
+			if _, ok := v["@context"]; !ok && context != nil {
+				v["@context"] = context
+			}
+			if t, ok := v["@type"]; ok {
+				v["@type"] = normalizeTypes(t)
+			}
+			items = append(items, sanitize(v).(map[string]any))
+		}
+	}
+	f(value, nil)
+
+	return items
+}
+
+func microdataItem(n *html.Node, base *url2.URL) map[string]any {
+	item := newItem(strings.Fields(attr(n, "itemtype")), attr(n, "itemid"), base)
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			nested := hasAttr(c, "itemscope")
+			if names := strings.Fields(attr(c, "itemprop")); len(names) > 0 {
+				var value any
+				if nested {
+					value = microdataItem(c, base)
+				} else {
+					value = propertyValue(c, base)
+				}
+				for _, name := range names {
+					addProperty(item, name, value)
+				}
+			}
+			if !nested {
+				f(c)
+			}
+		}
+	}
+	f(n)
+
+	return item
+}
+
+// rdfaItem reads the basic RDFa Lite subset: typeof, resource and property,
+// schema.org being the only vocabulary understood.
+func rdfaItem(n *html.Node, base *url2.URL) map[string]any {
+	item := newItem(strings.Fields(attr(n, "typeof")), attr(n, "resource"), base)
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			nested := hasAttr(c, "typeof")
+			if names := strings.Fields(attr(c, "property")); len(names) > 0 {
+				var value any
+				if nested {
+					value = rdfaItem(c, base)
+				} else {
+					value = propertyValue(c, base)
+				}
+				for _, name := range names {
+					addProperty(item, schemaName(name), value)
+				}
+			}
+			if !nested {
+				f(c)
+			}
+		}
+	}
+	f(n)
+
+	return item
+}
+
+func newItem(types []string, id string, base *url2.URL) map[string]any {
+	item := map[string]any{"@context": schemaContext}
+	if len(types) > 0 {
+		item["@type"] = normalizeTypes(types)
+	}
+	if id = strings.TrimSpace(id); id != "" {
+		item["@id"] = resolveUrl(base, id)
+	}
+	return item
+}
+
+// propertyValue is the value of a Microdata or RDFa property element, taken
+// from the attribute its tag holds it in, or else from its text.
+func propertyValue(n *html.Node, base *url2.URL) string {
+	if hasAttr(n, "content") {
+		return strings.TrimSpace(attr(n, "content"))
+	}
+	if resource := strings.TrimSpace(attr(n, "resource")); resource != "" {
+		return resolveUrl(base, resource)
+	}
+
+	switch n.Data {
+	case "a", "area", "link":
+		return resolveUrl(base, strings.TrimSpace(attr(n, "href")))
+	case "img", "audio", "video", "source", "track", "embed", "iframe":
+		return resolveUrl(base, strings.TrimSpace(attr(n, "src")))
+	case "object":
+		return resolveUrl(base, strings.TrimSpace(attr(n, "data")))
+	case "data", "meter":
+		return strings.TrimSpace(attr(n, "value"))
+	case "time":
+		if datetime := strings.TrimSpace(attr(n, "datetime")); datetime != "" {
+			return datetime
+		}
+	}
+	return nodeText(n)
+}
+
+// addProperty sets a property, turning it into a list from its second value.
+func addProperty(item map[string]any, name string, value any) {
+	switch existing := item[name].(type) {
+	case nil:
+		item[name] = value
+	case []any:
+		item[name] = append(existing, value)
+	default:
+		item[name] = []any{existing, value}
+	}
+}
+
+// normalizeTypes strips the schema.org namespace off a type or list of types,
+// a single type being kept as a plain string.
+func normalizeTypes(types any) any {
+	switch t := types.(type) {
+	case string:
+		return schemaName(t)
+	case []string:
+		if len(t) == 1 {
+			return schemaName(t[0])
+		}
+		names := make([]any, len(t))
+		for i, name := range t {
+			names[i] = schemaName(name)
+		}
+		return names
+	case []any:
+		names := make([]any, len(t))
+		for i, name := range t {
+			names[i] = normalizeTypes(name)
+		}
+		return names
+	}
+	return types
+}
+
+func schemaName(name string) string {
+	for _, prefix := range []string{"https://schema.org/", "http://schema.org/", "schema:"} {
+		if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+			return name[len(prefix):]
+		}
+	}
+	return name
+}
+
+// sanitize drops the keys MongoDB can't store, the ones starting with `$`.
+func sanitize(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, e := range v {
+			if strings.HasPrefix(key, "$") {
+				delete(v, key)
+				continue
+			}
+			v[key] = sanitize(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = sanitize(e)
+		}
+	}
+	return value
+}
+
+// scriptText is the raw content of a script element, whitespace included.
+func scriptText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// textBuilder accumulates whitespace-normalized text up to a word and byte
+// budget, 0 meaning unlimited. Runs of whitespace become a single space, and
+// block boundaries a single newline. The text stops at the last whole word
+// fitting in the budget.
+type textBuilder struct {
+	b         bytes.Buffer
+	maxWords  int
+	maxBytes  int
+	words     int
+	wordStart int
+	space     bool
+	newline   bool
+	full      bool
+}
+
+func newTextBuilder(opts Options) *textBuilder {
+	return &textBuilder{maxWords: opts.MaxWords, maxBytes: opts.MaxBytes}
+}
+
+// write adds the text of a text node. Words of adjacent nodes not separated by
+// whitespace, as in `foo<b>bar</b>`, are joined.
+func (t *textBuilder) write(s string) {
+	for len(s) > 0 && !t.full {
+		r, size := utf8.DecodeRuneInString(s)
+		if unicode.IsSpace(r) {
+			t.space = true
+			s = s[size:]
+			continue
+		}
+
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		t.writeWord(s[:end])
+		s = s[end:]
+	}
+}
+
+func (t *textBuilder) writeWord(word string) {
+	separator := ""
+	joined := false
+	switch {
+	case t.b.Len() == 0:
+	case t.newline:
+		separator = "\n"
+	case t.space:
+		separator = " "
+	default:
+		joined = true
+	}
+
+	if !joined && t.maxWords > 0 && t.words >= t.maxWords {
+		t.full = true
+		return
+	}
+	if t.maxBytes > 0 && t.b.Len()+len(separator)+len(word) > t.maxBytes {
+		// A WORD SPLIT ACROSS TEXT NODES IS DROPPED WHOLE
+		if joined {
+			t.b.Truncate(t.wordStart)
+			t.words--
+		}
+		t.full = true
+		return
+	}
+
+	if !joined {
+		t.wordStart = t.b.Len()
+		t.words++
+	}
+	t.b.WriteString(separator)
+	t.b.WriteString(word)
+	t.space, t.newline = false, false
+}
+
+// breakLine marks a block boundary, written as a newline before the next word.
+func (t *textBuilder) breakLine() {
+	t.newline = true
+}
+
+// breakWord marks a word boundary without any whitespace in the markup, as
+// between two table cells.
+func (t *textBuilder) breakWord() {
+	t.space = true
+}
+
+func (t *textBuilder) String() string {
+	return t.b.String()
+}
+
+// writeText writes the text under n, leaving out the elements skip tells.
+func writeText(t *textBuilder, n *html.Node, skip func(*html.Node) bool) {
+	if t.full {
+		return
+	}
+	switch n.Type {
+	case html.TextNode:
+		t.write(n.Data)
+		return
+	case html.ElementNode:
+		if skip(n) {
+			return
+		}
+	}
+
+	block := n.Type == html.ElementNode && breaksLine(n.Data)
+	if block {
+		t.breakLine()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(t, c, skip)
+	}
+	if block {
+		t.breakLine()
+	} else if n.Type == html.ElementNode && (n.Data == "td" || n.Data == "th") {
+		t.breakWord()
+	}
+}
+
+// breaksLine tells the elements whose content starts on a new line.
+func breaksLine(tag string) bool {
+	switch tag {
+	case "br", "hr", "li", "dt", "dd", "tr", "caption", "figcaption", "blockquote", "title", "body":
+		return true
+	}
+	return isBlock(tag)
+}
@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// largePageSize is roughly the size of the page the benchmarks extract from.
+const largePageSize = 4 << 20
+
+// largePage builds a multi-MB page by repeating the body of the article
+// fixture, boilerplate included, under a single <body>.
+func largePage(b *testing.B) *html.Node {
+	b.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", "article.html"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	page := string(content)
+	start := strings.Index(page, "<body>") + len("<body>")
+	end := strings.Index(page, "</body>")
+	if start < len("<body>") || end < start {
+		b.Fatal("article.html has no <body>")
+	}
+	head, body := page[:start], page[start:end]
+
+	var buf bytes.Buffer
+	buf.WriteString(head)
+	for buf.Len() < largePageSize {
+		buf.WriteString(body)
+	}
+	buf.WriteString("</body></html>")
+
+	doc, err := html.Parse(&buf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+func TestTextBuilder(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		write func(t *textBuilder)
+		want  string
+	}{
+		{"whitespace collapsed", Options{}, func(t *textBuilder) {
+			t.write("  one \t two\n\n three  ")
+		}, "one two three"},
+		{"words of adjacent nodes joined", Options{}, func(t *textBuilder) {
+			t.write("foo")
+			t.write("bar ")
+			t.write("baz")
+		}, "foobar baz"},
+		{"line break", Options{}, func(t *textBuilder) {
+			t.write("one ")
+			t.breakLine()
+			t.breakLine()
+			t.write(" two")
+		}, "one\ntwo"},
+		{"leading break dropped", Options{}, func(t *textBuilder) {
+			t.breakLine()
+			t.write("one")
+		}, "one"},
+		{"line break wins over space", Options{}, func(t *textBuilder) {
+			t.write("one ")
+			t.breakLine()
+			t.write("two")
+		}, "one\ntwo"},
+		{"word break", Options{}, func(t *textBuilder) {
+			t.write("one")
+			t.breakWord()
+			t.write("two")
+		}, "one two"},
+		{"word budget", Options{MaxWords: 2}, func(t *textBuilder) {
+			t.write("one two three")
+		}, "one two"},
+		{"word budget counts joined words once", Options{MaxWords: 2}, func(t *textBuilder) {
+			t.write("one tw")
+			t.write("o three")
+		}, "one two"},
+		{"byte budget keeps whole words", Options{MaxBytes: 10}, func(t *textBuilder) {
+			t.write("one two three")
+		}, "one two"},
+		{"byte budget counts the separator", Options{MaxBytes: 7}, func(t *textBuilder) {
+			t.write("one")
+			t.breakLine()
+			t.write("two three")
+		}, "one\ntwo"},
+		{"word split across nodes dropped whole", Options{MaxBytes: 10}, func(t *textBuilder) {
+			t.write("one tw")
+			t.write("othree")
+		}, "one"},
+		{"nothing written once full", Options{MaxWords: 1}, func(t *textBuilder) {
+			t.write("one two")
+			t.write("three")
+		}, "one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTextBuilder(tt.opts)
+			tt.write(b)
+			if got := b.String(); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		page string
+		want string
+	}{
+		{"inline elements joined", Options{}, "<p>foo<b>bar</b> baz</p>", "foobar baz"},
+		{"blocks on their own line", Options{}, "<p>one</p><p>two</p><div>three</div>", "one\ntwo\nthree"},
+		{"br breaks the line", Options{}, "<p>one<br>two</p>", "one\ntwo"},
+		{"table cells separated", Options{}, "<table><tr><td>a</td><td>b</td></tr><tr><td>c</td></tr></table>", "a b\nc"},
+		{"whitespace collapsed", Options{}, "<p>  one\n\t two  </p>", "one two"},
+		{"scripts and styles left out", Options{}, "<style>p{}</style><p>one</p><script>var x;</script>", "one"},
+		{"word budget", Options{MaxWords: 3}, "<p>one two</p><p>three four</p>", "one two\nthree"},
+		{"byte budget", Options{MaxBytes: 9}, "<p>one two</p><p>three</p>", "one two"},
+		{"byte budget drops a word cut across nodes", Options{MaxBytes: 9}, "<p>one fo<b>urteen</b></p>", "one"},
+		{"both budgets, bytes first", Options{MaxWords: 10, MaxBytes: 5}, "<p>one two three</p>", "one"},
+		{"both budgets, words first", Options{MaxWords: 1, MaxBytes: 100}, "<p>one two three</p>", "one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := extractText(doc, tt.opts); got != tt.want {
+				t.Errorf("extractText(%q) = %q, want %q", tt.page, got, tt.want)
+			}
+		})
+	}
+}
+
+var budgets = []struct {
+	name string
+	opts Options
+}{
+	{"unlimited", Options{}},
+	{"budget", Options{MaxWords: 500, MaxBytes: 64 << 10}},
+}
+
+func BenchmarkExtractText(b *testing.B) {
+	doc := largePage(b)
+	for _, budget := range budgets {
+		b.Run(budget.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(largePageSize)
+			for i := 0; i < b.N; i++ {
+				extractText(doc, budget.opts)
+			}
+		})
+	}
+}
+
+func BenchmarkExtractMainText(b *testing.B) {
+	doc := largePage(b)
+	for _, budget := range budgets {
+		b.Run(budget.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(largePageSize)
+			for i := 0; i < b.N; i++ {
+				extractMainText(doc, budget.opts)
+			}
+		})
+	}
+}
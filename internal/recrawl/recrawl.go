@@ -0,0 +1,72 @@
+package recrawl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+	"web-spider/internal/models"
+)
+
+// Policy adapts the revisit interval of each page to how often it changes: a
+// page found changed is revisited twice as soon, an unchanged one half as
+// often, always within [MinInterval, MaxInterval]. Pages crawled for the first
+// time start at InitialInterval.
+type Policy struct {
+	MinInterval     time.Duration
+	MaxInterval     time.Duration
+	InitialInterval time.Duration
+}
+
+// Next is the interval before the following visit of a page last revisited
+// after interval, 0 for a page never crawled before.
+func (p Policy) Next(interval time.Duration, changed bool) time.Duration {
+	switch {
+	case interval <= 0:
+		interval = p.InitialInterval
+	case changed:
+		interval /= 2
+	default:
+		interval *= 2
+	}
+	return min(max(interval, p.MinInterval), p.MaxInterval)
+}
+
+// Backoff is how far the next visit of a page is pushed back when it is picked
+// for a recrawl, in case the recrawl fails or is skipped: the time since the
+// page was last checked successfully, within [MinInterval, MaxInterval]. A
+// page failing over and over is then tried exponentially less often, and no
+// longer holds the place of the pages due after it.
+func (p Policy) Backoff(lastCheckedAt, now time.Time) time.Duration {
+	since := p.InitialInterval
+	if !lastCheckedAt.IsZero() {
+		since = now.Sub(lastCheckedAt)
+	}
+	return min(max(since, p.MinInterval), p.MaxInterval)
+}
+
+// Schedule sets the revisit interval and next visit time of a page fetched at
+// fetchedAt, given its previously stored version, nil if there is none. It
+// reports whether the content hash changed since that version.
+func (p Policy) Schedule(wp *models.WebPage, previous *models.WebPage, fetchedAt time.Time) bool {
+	wp.ContentHash = ContentHash(wp)
+
+	changed := previous == nil || previous.ContentHash != wp.ContentHash
+	var interval time.Duration
+	if previous != nil && previous.ContentHash != "" {
+		interval = previous.RevisitInterval
+	}
+	wp.RevisitInterval = p.Next(interval, changed)
+	wp.NextVisitAt = fetchedAt.Add(wp.RevisitInterval)
+
+	return changed
+}
+
+// ContentHash fingerprints what is indexed of a page, its title and text. It
+// is not the dedup TextHash, which leaves the title out.
+func ContentHash(wp *models.WebPage) string {
+	h := sha256.New()
+	h.Write([]byte(wp.Title))
+	h.Write([]byte{0})
+	h.Write([]byte(wp.Text))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package recrawl
+
+import (
+	"testing"
+	"time"
+	"web-spider/internal/models"
+)
+
+var policy = Policy{MinInterval: time.Hour, MaxInterval: 24 * time.Hour, InitialInterval: 4 * time.Hour}
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		lastCheckedAt time.Time
+		want          time.Duration
+	}{
+		{"never checked", time.Time{}, 4 * time.Hour},
+		{"time since the last check", now.Add(-6 * time.Hour), 6 * time.Hour},
+		{"at least the min interval", now.Add(-time.Minute), time.Hour},
+		{"at most the max interval", now.Add(-72 * time.Hour), 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Backoff(tt.lastCheckedAt, now); got != tt.want {
+				t.Errorf("Backoff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFailingPageDoesNotStarveOthers replays the recrawl polls of the crawler
+// over a week, picking one due page per poll and postponing it with Backoff
+// before its recrawl, against a page whose recrawl always fails.
+func TestFailingPageDoesNotStarveOthers(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	failing := &models.WebPage{Url: "http://a.test/", LastCheckedAt: start.Add(-4 * time.Hour), NextVisitAt: start, RevisitInterval: 4 * time.Hour}
+	healthy := &models.WebPage{Url: "http://b.test/", LastCheckedAt: start.Add(-4 * time.Hour), NextVisitAt: start.Add(time.Minute), RevisitInterval: 4 * time.Hour}
+	pages := []*models.WebPage{failing, healthy}
+
+	var failedAt []time.Time
+	recrawled := 0
+	for now := start; now.Before(start.Add(7 * 24 * time.Hour)); now = now.Add(10 * time.Minute) {
+		var due *models.WebPage
+		for _, page := range pages {
+			if !page.NextVisitAt.After(now) && (due == nil || page.NextVisitAt.Before(due.NextVisitAt)) {
+				due = page
+			}
+		}
+		if due == nil {
+			continue
+		}
+
+		due.NextVisitAt = now.Add(policy.Backoff(due.LastCheckedAt, now))
+		if due == failing {
+			failedAt = append(failedAt, now)
+			continue
+		}
+		recrawled++
+		due.LastCheckedAt = now
+		due.RevisitInterval = policy.Next(due.RevisitInterval, false)
+		due.NextVisitAt = now.Add(due.RevisitInterval)
+	}
+
+	// THE HEALTHY PAGE IS REVISITED AT 4h, 8h, 16h, THEN DAILY
+	if recrawled < 7 {
+		t.Errorf("healthy page recrawled %d times in a week, want at least 7", recrawled)
+	}
+	if len(failedAt) > 10 {
+		t.Errorf("failing page picked %d times in a week, want its retries to back off", len(failedAt))
+	}
+	for i := 2; i < len(failedAt); i++ {
+		if gap, previous := failedAt[i].Sub(failedAt[i-1]), failedAt[i-1].Sub(failedAt[i-2]); gap < previous {
+			t.Errorf("failing page retried after %v, then after %v, want growing gaps", previous, gap)
+		}
+	}
+}
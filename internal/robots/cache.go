@@ -0,0 +1,122 @@
+package robots
+
+import (
+	"context"
+	"io"
+	"net/http"
+	url2 "net/url"
+	"sync"
+	"time"
+)
+
+// Parsers are required to handle at least 500 KiB of robots.txt (RFC 9309).
+const maxRobotsSize = 500 * 1024
+
+type entry struct {
+	robots    *Robots
+	expiresAt time.Time
+	mu        sync.Mutex
+}
+
+type Checker struct {
+	UserAgent string
+	TTL       time.Duration
+	Client    *http.Client
+	entries   map[string]*entry
+	mu        sync.Mutex
+}
+
+func NewChecker(userAgent string, ttl time.Duration) *Checker {
+	return &Checker{
+		UserAgent: userAgent,
+		TTL:       ttl,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		entries:   make(map[string]*entry),
+	}
+}
+
+// Allowed tells whether robots.txt lets the checker's user agent fetch url.
+// Fetching the host's robots.txt, when it is not cached yet, is cancelled
+// along with ctx.
+func (c *Checker) Allowed(ctx context.Context, url string) bool {
+	u, err := url2.Parse(url)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	return c.robotsFor(ctx, u).Allowed(c.UserAgent, path)
+}
+
+func (c *Checker) CrawlDelay(ctx context.Context, url string) time.Duration {
+	u, err := url2.Parse(url)
+	if err != nil || u.Host == "" {
+		return 0
+	}
+
+	return c.robotsFor(ctx, u).CrawlDelay(c.UserAgent)
+}
+
+func (c *Checker) robotsFor(ctx context.Context, u *url2.URL) *Robots {
+	origin := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	e, ok := c.entries[origin]
+	if !ok {
+		e = &entry{}
+		c.entries[origin] = e
+	}
+	c.mu.Unlock()
+
+	// Holding the entry lock while fetching makes concurrent workers wait for
+	// a single robots.txt download per host instead of racing each other.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.robots == nil || time.Now().After(e.expiresAt) {
+		robots, ttl := c.fetch(ctx, origin)
+		// A CANCELLED FETCH SAYS NOTHING ABOUT THE HOST, IT IS NOT CACHED
+		if ctx.Err() != nil {
+			return robots
+		}
+		e.robots = robots
+		e.expiresAt = time.Now().Add(ttl)
+	}
+
+	return e.robots
+}
+
+func (c *Checker) fetch(ctx context.Context, origin string) (*Robots, time.Duration) {
+	// UNREACHABLE HOSTS ARE TREATED AS FULLY DISALLOWED, BUT RETRIED SOONER
+	retryTTL := min(c.TTL, time.Minute)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return DisallowAll(), retryTTL
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return DisallowAll(), retryTTL
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+		if err != nil {
+			return DisallowAll(), retryTTL
+		}
+		return Parse(string(body)), c.TTL
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return DisallowAll(), retryTTL
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return AllowAll(), c.TTL
+	default:
+		return DisallowAll(), retryTTL
+	}
+}
@@ -0,0 +1,180 @@
+package robots
+
+import (
+	"bufio"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type rule struct {
+	pattern string
+	allow   bool
+	matcher *regexp.Regexp
+}
+
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+type Robots struct {
+	groups []*group
+}
+
+func AllowAll() *Robots {
+	return &Robots{}
+}
+
+func DisallowAll() *Robots {
+	g := &group{agents: []string{"*"}}
+	g.rules = append(g.rules, newRule("/", false))
+	return &Robots{groups: []*group{g}}
+}
+
+func Parse(content string) *Robots {
+	r := &Robots{}
+
+	var current *group
+	// A `user-agent` line following any rule line starts a new group.
+	acceptingAgents := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if current == nil || !acceptingAgents {
+				current = &group{}
+				r.groups = append(r.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			acceptingAgents = true
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			acceptingAgents = false
+			// AN EMPTY `Disallow:` MEANS EVERYTHING IS ALLOWED
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, newRule(value, key == "allow"))
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			acceptingAgents = false
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	return r
+}
+
+func (r *Robots) Allowed(userAgent, path string) bool {
+	g := r.groupFor(userAgent)
+	if g == nil {
+		return true
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	// THE LONGEST MATCHING PATTERN WINS, `Allow` WINS ON TIES
+	allowed := true
+	longest := -1
+	for _, rl := range g.rules {
+		if !rl.matcher.MatchString(path) {
+			continue
+		}
+		if len(rl.pattern) > longest || (len(rl.pattern) == longest && rl.allow) {
+			longest = len(rl.pattern)
+			allowed = rl.allow
+		}
+	}
+
+	return allowed
+}
+
+func (r *Robots) CrawlDelay(userAgent string) time.Duration {
+	g := r.groupFor(userAgent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
+
+// groupFor returns the rules applying to userAgent: those of the groups naming
+// its product token, compared case-insensitively as a whole, or else those of
+// the `*` groups. Several groups naming the same agent are merged into one
+// (RFC 9309, section 2.2.1).
+func (r *Robots) groupFor(userAgent string) *group {
+	token := strings.ToLower(productToken(userAgent))
+
+	var matched, wildcards []*group
+	for _, g := range r.groups {
+		switch {
+		case slices.Contains(g.agents, token):
+			matched = append(matched, g)
+		case slices.Contains(g.agents, "*"):
+			wildcards = append(wildcards, g)
+		}
+	}
+	if len(matched) == 0 {
+		matched = wildcards
+	}
+
+	switch len(matched) {
+	case 0:
+		return nil
+	case 1:
+		return matched[0]
+	}
+	merged := &group{}
+	for _, g := range matched {
+		merged.rules = append(merged.rules, g.rules...)
+		merged.crawlDelay = max(merged.crawlDelay, g.crawlDelay)
+	}
+	return merged
+}
+
+func newRule(pattern string, allow bool) rule {
+	anchored := strings.HasSuffix(pattern, "$")
+	body := strings.TrimSuffix(pattern, "$")
+
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(body), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+
+	return rule{
+		pattern: pattern,
+		allow:   allow,
+		matcher: regexp.MustCompile(expr),
+	}
+}
+
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(userAgent, "/")
+	return strings.TrimSpace(token)
+}
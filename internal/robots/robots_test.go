@@ -0,0 +1,125 @@
+package robots
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		path    string
+		want    bool
+	}{
+		{"no rules", "", "/a", true},
+		{"empty disallow", "User-agent: *\nDisallow:", "/a", true},
+		{"disallow prefix", "User-agent: *\nDisallow: /private", "/private/a", false},
+		{"disallow other prefix", "User-agent: *\nDisallow: /private", "/public", true},
+		{"empty path is root", "User-agent: *\nDisallow: /", "", false},
+
+		{"longest match allows", "User-agent: *\nDisallow: /a\nAllow: /a/b", "/a/b/c", true},
+		{"longest match disallows", "User-agent: *\nAllow: /a\nDisallow: /a/b", "/a/b/c", false},
+		{"longest match ignores order", "User-agent: *\nAllow: /a/b\nDisallow: /a", "/a/b/c", true},
+		{"allow wins ties", "User-agent: *\nDisallow: /a\nAllow: /a", "/a", true},
+		{"allow wins ties in any order", "User-agent: *\nAllow: /a\nDisallow: /a", "/a", true},
+
+		{"star matches any run", "User-agent: *\nDisallow: /*.php", "/dir/index.php?x=1", false},
+		{"star matches empty run", "User-agent: *\nDisallow: /a*b", "/ab", false},
+		{"star needs the rest", "User-agent: *\nDisallow: /*.php", "/dir/index.html", true},
+		{"dollar anchors the end", "User-agent: *\nDisallow: /*.php$", "/index.php", false},
+		{"dollar rejects a longer path", "User-agent: *\nDisallow: /*.php$", "/index.php?x=1", true},
+		{"dollar on a plain path", "User-agent: *\nDisallow: /a$", "/a/b", true},
+		{"metacharacters are literal", "User-agent: *\nDisallow: /a.b", "/axb", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.content).Allowed("web-spider", tt.path); got != tt.want {
+				t.Errorf("Allowed(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupSelection(t *testing.T) {
+	const content = `
+User-agent: *
+Disallow: /everyone
+
+User-agent: spider
+Disallow: /spider
+
+User-agent: Web-Spider
+Disallow: /web-spider
+Crawl-delay: 1
+
+User-agent: other
+User-agent: WEB-SPIDER
+Disallow: /merged
+Crawl-delay: 3
+`
+	r := Parse(content)
+
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		want      bool
+	}{
+		{"exact token", "web-spider/1.0", "/web-spider", false},
+		{"case insensitive", "Web-Spider/1.0", "/web-spider", false},
+		{"groups of the same agent merged", "web-spider/1.0", "/merged", false},
+		{"no substring match", "web-spider/1.0", "/spider", true},
+		{"named agent ignores wildcard", "web-spider/1.0", "/everyone", true},
+		{"shorter token is its own agent", "spider", "/spider", false},
+		{"shorter token ignores longer one", "spider", "/web-spider", true},
+		{"unknown agent falls back to wildcard", "crawler/2.0", "/everyone", false},
+		{"wildcard ignores named groups", "crawler/2.0", "/spider", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Allowed(tt.userAgent, tt.path); got != tt.want {
+				t.Errorf("Allowed(%q, %q) = %v, want %v", tt.userAgent, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if got := r.CrawlDelay("web-spider/1.0"); got != 3*time.Second {
+		t.Errorf("CrawlDelay of merged groups = %v, want 3s", got)
+	}
+	if got := r.CrawlDelay("crawler"); got != 0 {
+		t.Errorf("CrawlDelay of wildcard group = %v, want 0", got)
+	}
+}
+
+func TestCheckerCancelledFetchIsNotCached(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// THE FIRST FETCH HANGS UNTIL THE CLIENT GIVES UP
+		if requests.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("User-agent: *\nDisallow: /"))
+	}))
+	defer server.Close()
+
+	checker := NewChecker("test-agent", time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	checker.Allowed(ctx, server.URL+"/a")
+
+	if checker.Allowed(context.Background(), server.URL+"/a") {
+		t.Error("Allowed after a cancelled fetch = true, want the robots.txt to be fetched again")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", got)
+	}
+}
@@ -0,0 +1,184 @@
+package scope
+
+import (
+	"errors"
+	"fmt"
+	url2 "net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrDomainNotAllowed = errors.New("domain is not allowed")
+	ErrDomainBlocked    = errors.New("domain is blocked")
+	ErrNotIncluded      = errors.New("url matches no include pattern")
+	ErrExcluded         = errors.New("url matches an exclude pattern")
+	ErrTooDeep          = errors.New("url is deeper than the max depth")
+	ErrHostLimit        = errors.New("host page limit reached")
+	ErrBlockedExtension = errors.New("file extension is blocked")
+)
+
+// Rules bound a crawl. Domains match themselves and their subdomains, and a
+// blocked domain wins over an allowed one. Include and Exclude are regular
+// expressions matched against the normalized url. Zero values disable a
+// rule.
+type Rules struct {
+	AllowedDomains    []string
+	BlockedDomains    []string
+	Include           []string
+	Exclude           []string
+	MaxDepth          int
+	MaxPagesPerHost   int
+	BlockedExtensions []string
+}
+
+type Scope struct {
+	Rules      Rules
+	include    []*regexp.Regexp
+	exclude    []*regexp.Regexp
+	extensions map[string]bool
+	hostPages  map[string]int
+	mu         sync.Mutex
+}
+
+func New(rules Rules) (*Scope, error) {
+	s := &Scope{
+		Rules:      rules,
+		extensions: make(map[string]bool, len(rules.BlockedExtensions)),
+		hostPages:  make(map[string]int),
+	}
+
+	var err error
+	if s.include, err = compile(rules.Include); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = compile(rules.Exclude); err != nil {
+		return nil, err
+	}
+	for _, ext := range rules.BlockedExtensions {
+		s.extensions["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = true
+	}
+
+	return s, nil
+}
+
+// Check tells why a url found at the given depth is out of scope, or returns
+// nil. It does not consume the host's page budget, see Admit.
+func (s *Scope) Check(url string, depth int) error {
+	if err := s.CheckRules(url, depth); err != nil {
+		return err
+	}
+
+	host, err := hostOf(url)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Rules.MaxPagesPerHost > 0 && s.hostPages[host] >= s.Rules.MaxPagesPerHost {
+		return ErrHostLimit
+	}
+
+	return nil
+}
+
+// CheckRules is Check without the host's page budget, for urls that don't
+// need a slot of their own, like a redirect target on the host of the page
+// that was admitted.
+func (s *Scope) CheckRules(url string, depth int) error {
+	if s.Rules.MaxDepth > 0 && depth > s.Rules.MaxDepth {
+		return ErrTooDeep
+	}
+
+	u, err := url2.Parse(url)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+
+	if matchDomain(s.Rules.BlockedDomains, host) {
+		return ErrDomainBlocked
+	}
+	if len(s.Rules.AllowedDomains) > 0 && !matchDomain(s.Rules.AllowedDomains, host) {
+		return ErrDomainNotAllowed
+	}
+	if s.extensions[strings.ToLower(path.Ext(u.Path))] {
+		return ErrBlockedExtension
+	}
+	if len(s.include) > 0 && !matchAny(s.include, url) {
+		return ErrNotIncluded
+	}
+	if matchAny(s.exclude, url) {
+		return ErrExcluded
+	}
+
+	return nil
+}
+
+// Admit counts a url against its host's page budget, reporting ErrHostLimit
+// if the budget is already spent.
+func (s *Scope) Admit(url string) error {
+	host, err := hostOf(url)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Rules.MaxPagesPerHost > 0 && s.hostPages[host] >= s.Rules.MaxPagesPerHost {
+		return ErrHostLimit
+	}
+	s.hostPages[host]++
+
+	return nil
+}
+
+// SameHost tells whether two urls are on the same host, and so share a page
+// budget.
+func SameHost(a, b string) bool {
+	hostA, errA := hostOf(a)
+	hostB, errB := hostOf(b)
+	return errA == nil && errB == nil && hostA == hostB
+}
+
+func hostOf(url string) (string, error) {
+	u, err := url2.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(u.Hostname()), nil
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope pattern `%s`: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchDomain(domains []string, host string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []*regexp.Regexp, url string) bool {
+	for _, re := range patterns {
+		if re.MatchString(url) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package scope
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	s, err := New(Rules{
+		AllowedDomains:    []string{"example.com", ".example.org"},
+		BlockedDomains:    []string{"private.example.com"},
+		Include:           []string{`^https?://[^/]+/(docs|blog)/`, `/a{2,3}$`},
+		Exclude:           []string{`/login`, `[?&]action=edit`},
+		MaxDepth:          2,
+		BlockedExtensions: []string{"JPG", ".pdf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		url   string
+		depth int
+		want  error
+	}{
+		{"in scope", "http://example.com/docs/intro", 1, nil},
+		{"subdomain allowed", "http://www.example.org/blog/post", 0, nil},
+		{"max depth reached", "http://example.com/docs/intro", 2, nil},
+		{"too deep", "http://example.com/docs/intro", 3, ErrTooDeep},
+		{"domain not allowed", "http://example.net/docs/intro", 0, ErrDomainNotAllowed},
+		{"domain suffix is not a subdomain", "http://notexample.com/docs/intro", 0, ErrDomainNotAllowed},
+		{"blocked subdomain wins", "http://private.example.com/docs/intro", 0, ErrDomainBlocked},
+		{"blocked domain case insensitive", "http://Private.Example.com/docs/intro", 0, ErrDomainBlocked},
+		{"blocked extension", "http://example.com/docs/photo.jpg", 0, ErrBlockedExtension},
+		{"blocked extension with dot", "http://example.com/docs/paper.PDF", 0, ErrBlockedExtension},
+		{"no include pattern matched", "http://example.com/about", 0, ErrNotIncluded},
+		{"pattern with a comma", "http://example.com/aaa", 0, nil},
+		{"pattern with a comma, no match", "http://example.com/aaaa", 0, ErrNotIncluded},
+		{"excluded path", "http://example.com/docs/login", 0, ErrExcluded},
+		{"excluded query", "http://example.com/docs/page?id=1&action=edit", 0, ErrExcluded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Check(tt.url, tt.depth); !errors.Is(err, tt.want) {
+				t.Errorf("Check(%q, %d) = %v, want %v", tt.url, tt.depth, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidPatterns(t *testing.T) {
+	if _, err := New(Rules{Include: []string{"("}}); err == nil {
+		t.Error("New with an invalid include pattern succeeded")
+	}
+	if _, err := New(Rules{Exclude: []string{"a{2,1}"}}); err == nil {
+		t.Error("New with an invalid exclude pattern succeeded")
+	}
+}
+
+func TestHostBudget(t *testing.T) {
+	s, err := New(Rules{MaxPagesPerHost: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{"http://example.com/a", "https://EXAMPLE.com:8443/b"} {
+		if err := s.Check(url, 0); err != nil {
+			t.Fatalf("Check(%q) = %v, want nil", url, err)
+		}
+		if err := s.Admit(url); err != nil {
+			t.Fatalf("Admit(%q) = %v, want nil", url, err)
+		}
+	}
+
+	// THE BUDGET IS PER HOST, WHATEVER THE SCHEME AND PORT
+	if err := s.Check("http://example.com/c", 0); !errors.Is(err, ErrHostLimit) {
+		t.Errorf("Check past the budget = %v, want ErrHostLimit", err)
+	}
+	if err := s.Admit("http://example.com/c"); !errors.Is(err, ErrHostLimit) {
+		t.Errorf("Admit past the budget = %v, want ErrHostLimit", err)
+	}
+	if err := s.CheckRules("http://example.com/c", 0); err != nil {
+		t.Errorf("CheckRules past the budget = %v, want nil", err)
+	}
+	if err := s.Check("http://www.example.com/a", 0); err != nil {
+		t.Errorf("Check on another host = %v, want nil", err)
+	}
+}
+
+func TestUnlimitedHostBudget(t *testing.T) {
+	s, err := New(Rules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := s.Admit("http://example.com/"); err != nil {
+			t.Fatalf("Admit #%d = %v, want nil", i, err)
+		}
+	}
+}
+
+func TestSameHost(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"http://example.com/a", "https://example.com/b/", true},
+		{"http://example.com/a", "http://EXAMPLE.COM:8080/a", true},
+		{"http://example.com/a", "http://www.example.com/a", false},
+		{"http://example.com/a", "://bad", false},
+	}
+	for _, tt := range tests {
+		if got := SameHost(tt.a, tt.b); got != tt.want {
+			t.Errorf("SameHost(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package spider
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"io"
+	"strings"
+)
+
+// acceptEncoding lists the content codings the fetcher decodes itself.
+const acceptEncoding = "gzip, deflate, br"
+
+// bombCheckFloor is the decoded size below which the decompression ratio is
+// not checked, small pages legitimately compress very well.
+const bombCheckFloor = 1 << 20
+
+var ErrCompressionBomb = errors.New("decompression ratio limit exceeded")
+
+// decodedBody is a response body with its content codings removed. Codings
+// lists the ones actually decoded, identity left out.
+type decodedBody struct {
+	io.Reader
+	Codings []string
+	closers []io.Closer
+}
+
+// Close releases the decoders, not the response body underneath.
+func (b *decodedBody) Close() error {
+	var errs []error
+	for _, c := range b.closers {
+		errs = append(errs, c.Close())
+	}
+	b.closers = nil
+	return errors.Join(errs...)
+}
+
+// decodeBody unwraps the content codings of a response body, listed in the
+// order they were applied.
+func decodeBody(body io.Reader, contentEncoding string) (*decodedBody, error) {
+	decoded := &decodedBody{Reader: body}
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		var r io.ReadCloser
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		switch coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(decoded.Reader)
+		case "deflate":
+			r, err = newDeflateReader(decoded.Reader)
+		case "br":
+			decoded.Reader = brotli.NewReader(decoded.Reader)
+		default:
+			err = fmt.Errorf("unsupported content encoding `%s`", coding)
+		}
+		if err != nil {
+			decoded.Close()
+			return nil, err
+		}
+		if r != nil {
+			decoded.Reader = r
+			decoded.closers = append(decoded.closers, r)
+		}
+		decoded.Codings = append(decoded.Codings, coding)
+	}
+	return decoded, nil
+}
+
+// newDeflateReader reads `deflate` bodies, which should be zlib streams but
+// are sent as raw deflate by some servers.
+func newDeflateReader(body io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(body)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ratioLimitReader fails a decoded body growing more than maxRatio times
+// larger than the bytes read off the wire.
+type ratioLimitReader struct {
+	countingReader
+	wire     *countingReader
+	maxRatio float64
+	bomb     bool
+}
+
+func (r *ratioLimitReader) Read(p []byte) (int, error) {
+	n, err := r.countingReader.Read(p)
+	if r.maxRatio > 0 && r.n > bombCheckFloor && float64(r.n) > float64(r.wire.n)*r.maxRatio {
+		r.bomb = true
+		return n, fmt.Errorf("%w: %d bytes decoded from %d", ErrCompressionBomb, r.n, r.wire.n)
+	}
+	return n, err
+}
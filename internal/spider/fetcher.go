@@ -0,0 +1,248 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	url2 "net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web-spider/internal/models"
+)
+
+var (
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrBodyTooLarge     = errors.New("response body too large")
+	ErrNotModified      = errors.New("not modified")
+	ErrRedirectBlocked  = errors.New("redirect target not allowed")
+)
+
+const (
+	OversizeTruncate = "truncate"
+	OversizeReject   = "reject"
+)
+
+type FetcherOptions struct {
+	UserAgent string
+	// From is the contact address sent in the From header, left out if empty.
+	From string
+	// ConnectTimeout bounds the TCP and TLS handshakes, ReadTimeout the wait
+	// for the response headers and then for each chunk of the body, Timeout
+	// the whole request.
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Timeout        time.Duration
+	// MaxConnsPerHost caps the open connections to a single host, 0 means
+	// unlimited.
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+	// MaxBodySize caps the bytes read from a response body, 0 means
+	// unlimited. Past it OversizePolicy either truncates the body or rejects
+	// the page with ErrBodyTooLarge.
+	MaxBodySize    int64
+	OversizePolicy string
+	// MaxDecompressionRatio fails bodies decoding to more than that many
+	// times their wire size, 0 disables the check.
+	MaxDecompressionRatio float64
+	// MaxRedirects is the longest redirect chain followed, 0 follows none.
+	MaxRedirects int
+	// Proxy is a proxy url. When empty the HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY environment variables are honored.
+	Proxy string
+}
+
+// Fetcher downloads pages through a single tuned http.Client shared by all the
+// crawling goroutines.
+type Fetcher struct {
+	Options FetcherOptions
+	Client  *http.Client
+}
+
+func NewFetcher(opts FetcherOptions) (*Fetcher, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxyUrl, err := url2.Parse(opts.Proxy)
+		if err != nil || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url `%s`", opts.Proxy)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+		// CONTENT CODINGS ARE NEGOTIATED AND DECODED BY THE FETCHER ITSELF
+		DisableCompression: true,
+	}
+
+	f := &Fetcher{Options: opts}
+	f.Client = &http.Client{
+		Transport:     transport,
+		Timeout:       opts.Timeout,
+		CheckRedirect: f.checkRedirect,
+	}
+
+	return f, nil
+}
+
+// NewRequest builds a GET request carrying the fetcher's identification and
+// content negotiation headers.
+func (f *Fetcher) NewRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.Options.UserAgent)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if f.Options.From != "" {
+		req.Header.Set("From", f.Options.From)
+	}
+
+	return req, nil
+}
+
+// Validators are the cache validators of a previous fetch of a page, sent
+// back as conditional request headers so an unchanged page answers 304.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+func (v Validators) setHeaders(req *http.Request) {
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+type redirectsKey struct{}
+
+// withRedirects makes the requests sent with ctx record their redirect hops
+// in chain.
+func withRedirects(ctx context.Context, chain *[]models.Redirect) context.Context {
+	return context.WithValue(ctx, redirectsKey{}, chain)
+}
+
+type redirectCheckKey struct{}
+
+// WithRedirectCheck makes the requests sent with ctx follow a redirect only
+// when check accepts its target, failing with ErrRedirectBlocked otherwise,
+// so redirects get the same robots.txt and scope checks as discovered links.
+func WithRedirectCheck(ctx context.Context, check func(url string) error) context.Context {
+	return context.WithValue(ctx, redirectCheckKey{}, check)
+}
+
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if chain, ok := req.Context().Value(redirectsKey{}).(*[]models.Redirect); ok && req.Response != nil {
+		*chain = append(*chain, models.Redirect{
+			Url:        via[len(via)-1].URL.String(),
+			StatusCode: req.Response.StatusCode,
+			Location:   req.URL.String(),
+		})
+	}
+
+	if len(via) > f.Options.MaxRedirects {
+		if f.Options.MaxRedirects == 0 {
+			return http.ErrUseLastResponse
+		}
+		return fmt.Errorf("%w after %d hops", ErrTooManyRedirects, f.Options.MaxRedirects)
+	}
+	if check, ok := req.Context().Value(redirectCheckKey{}).(func(string) error); ok {
+		if err := check(req.URL.String()); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrRedirectBlocked, req.URL, err)
+		}
+	}
+	return nil
+}
+
+// idleTimeoutReader cancels the request when no byte of the body arrives for
+// longer than timeout, so a server trickling its response can't hold a worker
+// until the total timeout.
+type idleTimeoutReader struct {
+	r        io.Reader
+	timer    *time.Timer
+	d        time.Duration
+	timedOut atomic.Bool
+	once     sync.Once
+}
+
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	t := &idleTimeoutReader{r: r, d: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		t.timedOut.Store(true)
+		cancel()
+	})
+	return t
+}
+
+func (t *idleTimeoutReader) Read(p []byte) (int, error) {
+	t.timer.Reset(t.d)
+	n, err := t.r.Read(p)
+	if err != nil {
+		t.stop()
+		if t.timedOut.Load() {
+			err = fmt.Errorf("%w: no data received for %v", ErrReadTimeout, t.d)
+		}
+	}
+	return n, err
+}
+
+func (t *idleTimeoutReader) stop() {
+	t.once.Do(func() { t.timer.Stop() })
+}
+
+// sizeLimitReader stops a body at max bytes. Reading on past the limit ends
+// the body early with the truncate policy, or fails with ErrBodyTooLarge with
+// the reject policy.
+type sizeLimitReader struct {
+	r        io.Reader
+	max      int64
+	n        int64
+	policy   string
+	exceeded bool
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.max <= 0 {
+		return l.r.Read(p)
+	}
+
+	if l.n >= l.max {
+		// ONLY A BODY WITH BYTES LEFT PAST THE LIMIT IS OVERSIZED
+		var probe [1]byte
+		n, err := io.ReadFull(l.r, probe[:])
+		if n == 0 {
+			return 0, err
+		}
+		l.exceeded = true
+		if l.policy == OversizeReject {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, l.max)
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > l.max-l.n {
+		p = p[:l.max-l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	return n, err
+}
@@ -1,45 +1,216 @@
 package spider
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"golang.org/x/net/html/charset"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 	"web-spider/internal/metrics"
+	"web-spider/internal/models"
 )
 
-func DownloadHTML(url string, stats *metrics.CrawlerStats) (string, error) {
-	resp, err := http.Get(url)
+// charsetSniffLen is how much of the body the HTML5 encoding sniffing
+// algorithm looks at.
+const charsetSniffLen = 1024
+
+// Download is a fetched HTML page whose body is streamed from the connection.
+// FinalUrl differs from Url when the request was redirected, Redirects then
+// holds every hop. Body is transcoded to UTF-8 from the detected Charset. ETag
+// and LastModified are the validators to revalidate the page with later.
+// ResponseTime is how long the response headers took to arrive. It must be
+// closed once the body is consumed.
+type Download struct {
+	Url          string
+	FinalUrl     string
+	Redirects    []models.Redirect
+	StatusCode   int
+	ContentType  string
+	ResponseTime time.Duration
+	Charset      string
+	ETag         string
+	LastModified string
+	Body         io.Reader
+	resp         *http.Response
+	limit        *sizeLimitReader
+	timeout      *idleTimeoutReader
+	wire         *countingReader
+	codings      *decodedBody
+	decoded      *ratioLimitReader
+	cancel       context.CancelFunc
+	stats        *metrics.CrawlerStats
+}
+
+// WireBytes is the size of the body read off the connection so far.
+func (d *Download) WireBytes() int64 {
+	return d.wire.n
+}
+
+// DecodedBytes is the size of the body read so far once its content codings
+// are removed.
+func (d *Download) DecodedBytes() int64 {
+	return d.decoded.n
+}
+
+// Truncated reports whether the body was cut at the max body size.
+func (d *Download) Truncated() bool {
+	return d.limit.exceeded && d.limit.policy == OversizeTruncate
+}
+
+func (d *Download) Close() error {
+	if d.timeout != nil {
+		d.timeout.stop()
+	}
+	var err error
+	if d.codings != nil {
+		err = d.codings.Close()
+	}
+	err = errors.Join(err, d.resp.Body.Close())
+	d.cancel()
+
+	d.stats.MU.Lock()
+	defer d.stats.MU.Unlock()
+	d.stats.WireBytes += d.wire.n
+	if d.decoded != nil {
+		d.stats.DecodedBytes += d.decoded.n
+		if d.decoded.bomb {
+			d.stats.CompressionBombs++
+		}
+	}
+	if d.codings != nil && len(d.codings.Codings) > 0 {
+		d.stats.CompressedPages++
+	}
+	if d.limit != nil && d.limit.exceeded {
+		if d.limit.policy == OversizeTruncate {
+			d.stats.TruncatedPages++
+		} else {
+			d.stats.OversizedPages++
+		}
+	}
+
+	return err
+}
+
+// DownloadHTML fetches url, conditionally when validators of a previous fetch
+// are given, in which case an unchanged page fails with ErrNotModified.
+func (f *Fetcher) DownloadHTML(ctx context.Context, url string, validators Validators, stats *metrics.CrawlerStats) (*Download, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var redirects []models.Redirect
+	req, err := f.NewRequest(withRedirects(ctx, &redirects), url)
 	if err != nil {
-		return "", err
+		cancel()
+		return nil, err
+	}
+	validators.setHeaders(req)
+
+	start := time.Now()
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	discard := func() {
+		resp.Body.Close()
+		cancel()
+	}
+
+	// HANDLE UNCHANGED PAGES
+	if resp.StatusCode == http.StatusNotModified {
+		discard()
+		stats.MU.Lock()
+		stats.NotModifiedPages++
+		stats.MU.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNotModified, url)
 	}
-	defer resp.Body.Close()
 
 	// HANDLE NON-OK RESPONSES
 	if resp.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("Non-OK HTTP status for %s: %d\n", url, resp.StatusCode)
+		discard()
 		stats.MU.Lock()
 		stats.HTTPErrors++
 		stats.MU.Unlock()
-		return "", errors.New(errMsg)
+		return nil, &FetchError{
+			Url:        url,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
 	// HANDLE CONTENT TYPES AS SO IT'S ONLY a text/html CONTENT-TYPE
 	contentType := resp.Header.Get("Content-Type")
 	if !strings.Contains(contentType, "text/html") {
+		discard()
 		errMsg := fmt.Sprintf("Skipping non-HTML content at %s (Content-Type: %s)\n", url, contentType)
-		return "", errors.New(errMsg)
+		return nil, errors.New(errMsg)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	// HANDLE ANNOUNCED OVERSIZED BODIES BEFORE DOWNLOADING ANY OF IT
+	maxSize := f.Options.MaxBodySize
+	if maxSize > 0 && resp.ContentLength > maxSize && f.Options.OversizePolicy == OversizeReject {
+		discard()
+		stats.MU.Lock()
+		stats.OversizedPages++
+		stats.MU.Unlock()
+		return nil, fmt.Errorf("%w: %s announces %d bytes", ErrBodyTooLarge, url, resp.ContentLength)
+	}
+
+	download := &Download{
+		Url:          url,
+		FinalUrl:     resp.Request.URL.String(),
+		Redirects:    redirects,
+		StatusCode:   resp.StatusCode,
+		ContentType:  contentType,
+		ResponseTime: time.Since(start),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		resp:         resp,
+		cancel:       cancel,
+		stats:        stats,
+	}
+
+	var reader io.Reader = resp.Body
+	if f.Options.ReadTimeout > 0 {
+		download.timeout = newIdleTimeoutReader(reader, f.Options.ReadTimeout, cancel)
+		reader = download.timeout
+	}
+	download.wire = &countingReader{r: reader}
+
+	// DECODE THE CONTENT CODINGS, THE SIZE LIMIT APPLIES TO THE DECODED BODY
+	download.codings, err = decodeBody(download.wire, resp.Header.Get("Content-Encoding"))
 	if err != nil {
-		return "", err
+		download.Close()
+		return nil, err
 	}
+	download.decoded = &ratioLimitReader{
+		countingReader: countingReader{r: download.codings},
+		wire:           download.wire,
+		maxRatio:       f.Options.MaxDecompressionRatio,
+	}
+	download.limit = &sizeLimitReader{r: download.decoded, max: maxSize, policy: f.Options.OversizePolicy}
+
+	// DETECT THE CHARSET FROM THE BOM, THE Content-Type HEADER OR THE <meta>
+	// TAGS OF THE FIRST KiB, THEN TRANSCODE THE REST OF THE STREAM TO UTF-8
+	buffered := bufio.NewReader(download.limit)
+	head, err := buffered.Peek(charsetSniffLen)
+	if err != nil && err != io.EOF {
+		download.Close()
+		return nil, err
+	}
+	encoding, name, _ := charset.DetermineEncoding(head, contentType)
+	download.Charset = name
+	download.Body = encoding.NewDecoder().Reader(buffered)
 
 	stats.MU.Lock()
 	stats.HTMLPages++
+	if len(redirects) > 0 {
+		stats.RedirectedPages++
+	}
 	stats.MU.Unlock()
 
-	return string(body), nil
+	return download, nil
 }
@@ -0,0 +1,135 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrReadTimeout = errors.New("read timeout")
+
+// FetchError is returned for responses with an unexpected HTTP status.
+type FetchError struct {
+	Url        string
+	StatusCode int
+	// RetryAfter is the delay asked by the server in a `Retry-After` header,
+	// 0 if there was none.
+	RetryAfter time.Duration
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("Non-OK HTTP status for %s: %d", e.Url, e.StatusCode)
+}
+
+// RetryPolicy decides whether and when a failed fetch is tried again. Delays
+// grow exponentially from BaseDelay up to MaxDelay, each randomly moved by up
+// to Jitter (a fraction of the delay) so retries to a host don't line up.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+// Next reports how long to wait before retrying a fetch that failed with err
+// on its given attempt, counted from 1. A `Retry-After` delay longer than
+// MaxDelay gives up on the url rather than stalling it.
+func (p RetryPolicy) Next(err error, attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !Retryable(err) {
+		return 0, false
+	}
+
+	delay := p.Backoff(attempt)
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) && fetchErr.RetryAfter > 0 {
+		if fetchErr.RetryAfter > p.MaxDelay {
+			return 0, false
+		}
+		delay = max(delay, fetchErr.RetryAfter)
+	}
+
+	return delay, true
+}
+
+// Backoff is the jittered delay before the retry following the given attempt.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+
+	if spread := int64(float64(delay) * p.Jitter); spread > 0 {
+		delay += time.Duration(rand.Int63n(2*spread+1) - spread)
+	}
+
+	return max(delay, 0)
+}
+
+// Retryable tells transient failures, worth trying again later, from
+// permanent ones. A bare io.EOF is not one of them, only a body cut short
+// with io.ErrUnexpectedEOF or a broken connection is.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		switch fetchErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	return errors.Is(err, ErrReadTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// StatusCode is the HTTP status behind a fetch error, 0 for network errors.
+func StatusCode(err error) int {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.StatusCode
+	}
+	return 0
+}
+
+// parseRetryAfter reads a `Retry-After` header, given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
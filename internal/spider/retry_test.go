@@ -0,0 +1,131 @@
+package spider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.5}
+
+	for attempt, delay := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 8: 10 * time.Second} {
+		low, high := delay/2, delay+delay/2
+		for i := 0; i < 100; i++ {
+			if got := policy.Backoff(attempt); got < low || got > high {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", attempt, got, low, high)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "120", 2 * time.Minute},
+		{"seconds with spaces", " 5 ", 5 * time.Second},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-10", 0},
+		{"http date", "Wed, 01 May 2024 12:01:30 GMT", 90 * time.Second},
+		{"http date in the past", "Wed, 01 May 2024 11:00:00 GMT", 0},
+		{"fraction", "1.5", 0},
+		{"garbage", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+	unavailable := func(retryAfter time.Duration) error {
+		return &FetchError{Url: "http://example.com/", StatusCode: http.StatusServiceUnavailable, RetryAfter: retryAfter}
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		want    time.Duration
+		retry   bool
+	}{
+		{"backoff", unavailable(0), 1, time.Second, true},
+		{"retry after longer than backoff", unavailable(30 * time.Second), 1, 30 * time.Second, true},
+		{"retry after shorter than backoff", unavailable(time.Second), 2, 2 * time.Second, true},
+		{"retry after past the cap", unavailable(2 * time.Minute), 1, 0, false},
+		{"attempts spent", unavailable(0), 3, 0, false},
+		{"permanent error", &FetchError{StatusCode: http.StatusNotFound}, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, retry := policy.Next(tt.err, tt.attempt)
+			if got != tt.want || retry != tt.retry {
+				t.Errorf("Next = %v, %v, want %v, %v", got, retry, tt.want, tt.retry)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", context.Canceled, false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"read timeout", fmt.Errorf("reading body: %w", ErrReadTimeout), true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"body cut short", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"bare eof", io.EOF, false},
+		{"too many requests", &FetchError{StatusCode: http.StatusTooManyRequests}, true},
+		{"bad gateway", &FetchError{StatusCode: http.StatusBadGateway}, true},
+		{"not found", &FetchError{StatusCode: http.StatusNotFound}, false},
+		{"other", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}